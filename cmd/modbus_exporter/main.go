@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -13,6 +16,8 @@ import (
 	"github.com/NobleD5/modbus_exporter/pkg/config"
 	"github.com/NobleD5/modbus_exporter/pkg/handler"
 	"github.com/NobleD5/modbus_exporter/pkg/logger"
+	"github.com/NobleD5/modbus_exporter/pkg/master"
+	"github.com/NobleD5/modbus_exporter/pkg/poller"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
 	"github.com/go-kit/kit/log"
@@ -41,16 +46,26 @@ var (
 	// KINGPIN flags
 	app = kingpin.New(filepath.Base(os.Args[0]), "The Modbus Exporter")
 
+	// commands, metrics are served unless config check is asked for
+	serveCommand       = app.Command("serve", "Serve MODBUS metrics (default).").Default()
+	checkConfigCommand = app.Command("check-config", "Check config file (or directory), print a summary and exit with non-zero code on errors.")
+
 	// main config flag
-	configFile = app.Flag("config.file", "Config file (or directory with multiple files) which contains list of devices with modbus-registers.").Required().String()
+	configFile = app.Flag("config.file", "Config file, directory of YAML files or glob pattern (e.g. 'conf.d/*.yaml') which contains list of devices with modbus-registers.").Required().String()
 	// app options flags
 	listenAddress      = app.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").Default(":9700").String()
 	metricsPath        = app.Flag("web.metrics-path", "Path under which to expose MODBUS metrics.").Default("/modbus").String()
 	telemetryPath      = app.Flag("web.telemetry-path", "Path under which to expose telemetry metrics.").Default("/metrics").String()
+	targetsPath        = app.Flag("web.targets-path", "Path under which to expose MODBUS metrics of all the configured targets.").Default("/targets").String()
+	sdPath             = app.Flag("web.sd-path", "Path under which to expose the configured targets for Prometheus HTTP service discovery.").Default("/sd").String()
 	externalURL        = app.Flag("web.external-url", "The URL under which the Pushgateway is externally reachable.").Default("").URL()
 	routePrefix        = app.Flag("web.route-prefix", "Prefix for the internal routes of web endpoints. Defaults to the path of --web.external-url.").Default("").String()
 	insecureSkipVerify = app.Flag("web.insecure", "Skip verification in requests.").Bool()
 	logLevel           = app.Flag("log.level", "Log level. Valid are next values: DEBUG, INFO, WARN, ERROR.").Default("INFO").String()
+	// scheduler options flags
+	schedulerMaxInFlight = app.Flag("scheduler.max-in-flight", "Scrapes of the same target running at once, serial gateways handle one transaction at a time.").Default("1").Int()
+	schedulerDelay       = app.Flag("scheduler.delay", "Silent interval between consecutive scrapes of the same target.").Default("0s").Duration()
+	targetsMaxParallel   = app.Flag("targets.max-parallel", "Configured targets scraped at once by a single request.").Default("4").Int()
 
 	// Metrics about the exporter itself
 	modbusDuration = prometheus.NewSummaryVec(
@@ -74,6 +89,7 @@ func init() {
 
 	prometheus.MustRegister(modbusDuration)
 	prometheus.MustRegister(modbusRequestErrors)
+	prometheus.MustRegister(master.SchedulerCollectors...)
 	prometheus.Register(version.NewCollector("modbus_exporter"))
 
 }
@@ -82,7 +98,11 @@ func main() {
 
 	app.Version(version.Print("modbus_exporter"))
 	app.HelpFlag.Short('h')
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	if command == checkConfigCommand.FullCommand() {
+		os.Exit(checkConfig(os.Stdout, *configFile))
+	}
 
 	logger := logger.SetupLogger(*logLevel)
 
@@ -94,6 +114,7 @@ func main() {
 		"config", *configFile,
 		"metrics", *metricsPath,
 		"telemetry", *telemetryPath,
+		"targets", *targetsPath,
 		"url", *externalURL,
 	)
 
@@ -105,6 +126,24 @@ func main() {
 		"logs", *logLevel,
 	)
 
+	level.Info(logger).Log(
+		"msg", "KINGPIN would use this provided scheduler flags:",
+		"max_in_flight", *schedulerMaxInFlight,
+		"delay", *schedulerDelay,
+		"targets_max_parallel", *targetsMaxParallel,
+	)
+
+	if *targetsMaxParallel < 1 {
+		level.Error(logger).Log("msg", "Targets scraped at once must be at least 1", "max_parallel", *targetsMaxParallel)
+		os.Exit(1)
+	}
+	if *schedulerMaxInFlight < 1 {
+		level.Error(logger).Log("msg", "Scheduler max in-flight scrapes must be at least 1", "max_in_flight", *schedulerMaxInFlight)
+		os.Exit(1)
+	}
+	master.DefaultScheduler.MaxInFlight = *schedulerMaxInFlight
+	master.DefaultScheduler.Delay = *schedulerDelay
+
 	level.Info(logger).Log("msg", "Starting MODBUS-exporter", "version", version.Info())
 	level.Info(logger).Log("build_context", version.BuildContext())
 
@@ -139,7 +178,17 @@ func main() {
 
 	// signal.Notify(hup, syscall.SIGHUP)
 
-	go reloadConfigOnReload(safeConfig, reload, logger)
+	// Targets with 'device_poll_targets' are polled in background
+	modbusPoller := poller.New(safeConfig, logger)
+	modbusPoller.Start()
+
+	go reloadConfigOnReload(safeConfig, modbusPoller, reload, logger)
+
+	// Targets discovered by Prometheus are scraped from the external URL, if set
+	sdAddress := ""
+	if *externalURL != nil {
+		sdAddress = (*externalURL).Host
+	}
 
 	// Creating new route
 	r := route.New()
@@ -165,7 +214,9 @@ func main() {
 	// ---------------------------------------------------------------------------
 
 	// --------- MAIN endpoint for MODBUS metrics scrapes ------------------------
-	r.Get((*routePrefix + *metricsPath), handler.Modbus(safeConfig, logger).ServeHTTP)
+	r.Get((*routePrefix + *metricsPath), handler.Modbus(safeConfig, modbusPoller, logger).ServeHTTP)
+	r.Get((*routePrefix + *targetsPath), handler.Targets(safeConfig, modbusPoller, *targetsMaxParallel, logger).ServeHTTP)
+	r.Get((*routePrefix + *sdPath), handler.ServiceDiscovery(safeConfig, sdAddress, *routePrefix+*metricsPath, logger).ServeHTTP)
 	// ---------------------------------------------------------------------------
 
 	// -------- MAIN endpoint for telemetry metrics scrapes ----------------------
@@ -210,6 +261,60 @@ func reloadConfig(sc *structures.SafeConfig, newConf string, logger log.Logger)
 	return nil
 }
 
+// checkConfig loads and checks the config, prints found problems and warnings
+// followed by a summary, returns exit code (non-zero on problems)
+func checkConfig(w io.Writer, configFile string) int {
+
+	// Problems are printed, not logged
+	logger := log.NewNopLogger()
+
+	fmt.Fprintf(w, "Checking %s\n", configFile)
+
+	loaded, error := config.Load(configFile, logger)
+	if error != nil {
+		var problems config.ValidationErrors
+		if !errors.As(error, &problems) {
+			fmt.Fprintf(w, "  FAILED: %s\n", error.Error())
+			return 1
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(w, "  ERROR: %s\n", problem.Error())
+		}
+		fmt.Fprintf(w, "  FAILED: %d error(s)\n", len(problems))
+		return 1
+	}
+
+	problems, warnings := config.CheckConf(loaded, logger)
+	for _, problem := range problems {
+		fmt.Fprintf(w, "  ERROR: %s\n", problem.Error())
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "  WARNING: %s\n", warning.Error())
+	}
+
+	registers := 0
+	for _, params := range loaded.Devices {
+		if params == nil {
+			continue
+		}
+		registers += len(params.DeviceRegisters)
+		for _, unit := range params.DeviceUnits {
+			registers += len(unit.UnitRegisters)
+		}
+	}
+
+	summary := fmt.Sprintf("%d device(s), %d register(s), %d target(s), %d error(s), %d warning(s)",
+		len(loaded.Devices), registers, len(loaded.Targets), len(problems), len(warnings))
+
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "  FAILED: %s\n", summary)
+		return 1
+	}
+
+	fmt.Fprintf(w, "  SUCCESS: %s\n", summary)
+	return 0
+}
+
 // computeRoutePrefix returns the effective route prefix based on the
 // provided flag values for --web.route-prefix and
 // --web.external-url. With prefix empty, the path of externalURL is
@@ -252,8 +357,8 @@ func closeListenerOnQuit(listener net.Listener, quit <-chan bool, logger log.Log
 }
 
 // reloadConfigOnReload will try to reload current config with a new one upon receiving 'reload'
-// or upon receiving a SIGHUP.
-func reloadConfigOnReload(safeConfig *structures.SafeConfig, reload <-chan bool, logger log.Logger) {
+// or upon receiving a SIGHUP, background polling is restarted with the new config.
+func reloadConfigOnReload(safeConfig *structures.SafeConfig, modbusPoller *poller.Poller, reload <-chan bool, logger log.Logger) {
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGHUP)
@@ -264,11 +369,15 @@ func reloadConfigOnReload(safeConfig *structures.SafeConfig, reload <-chan bool,
 			level.Warn(logger).Log("msg", "Received SIGHUP, trying to reload configuration...")
 			if err := reloadConfig(safeConfig, *configFile, logger); err != nil {
 				level.Error(logger).Log("msg", "Error reloading configuration", "err", err.Error())
+			} else {
+				modbusPoller.Restart()
 			}
 		case <-reload:
 			level.Warn(logger).Log("msg", "Received reload request via web service, trying to reload configuration...")
 			if err := reloadConfig(safeConfig, *configFile, logger); err != nil {
 				level.Error(logger).Log("msg", "Error reloading configuration", "err", err.Error())
+			} else {
+				modbusPoller.Restart()
 			}
 		}
 
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	// "net/http"
 	// "net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	// "os/signal"
 	// "syscall"
 	"testing"
@@ -14,6 +16,7 @@ import (
 	"github.com/NobleD5/modbus_exporter/pkg/config"
 	// "github.com/NobleD5/modbus_exporter/pkg/handler"
 	"github.com/NobleD5/modbus_exporter/pkg/logger"
+	"github.com/NobleD5/modbus_exporter/pkg/poller"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
 	// "github.com/go-kit/kit/log"
@@ -64,6 +67,43 @@ func TestReloadConfig(t *testing.T) {
 	}
 }
 
+func TestCheckConfig(t *testing.T) {
+
+	invalid := t.TempDir() + "/modbus.yaml"
+	err := os.WriteFile(invalid, []byte("PLC:\n  device_timeout: 300\n  device_registers:\n    - register_name: U_A\n      register_address: dec#abc\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test 1 --------------------------------------------------------------------
+	var out bytes.Buffer
+	code := checkConfig(&out, "valid_modbus_conf.yaml")
+	if code == 0 && strings.Contains(out.String(), "SUCCESS: 2 device(s), 16 register(s), 0 target(s), 0 error(s), 0 warning(s)") {
+		t.Log("checkConfig() : Test 1 PASSED.")
+	} else {
+		t.Errorf("checkConfig() : Test 1 FAILED, exit code: %d, output: %s", code, out.String())
+	}
+
+	// Test 2 --------------------------------------------------------------------
+	out.Reset()
+	code = checkConfig(&out, invalid)
+	if code == 1 && strings.Count(out.String(), "ERROR: "+invalid+": device 'PLC'") == 2 && strings.Contains(out.String(), "FAILED: 2 error(s)") {
+		t.Log("checkConfig() : Test 2 PASSED.")
+	} else {
+		t.Errorf("checkConfig() : Test 2 FAILED, exit code: %d, output: %s", code, out.String())
+	}
+
+	// Test 3 --------------------------------------------------------------------
+	out.Reset()
+	code = checkConfig(&out, "noexist.yaml")
+	if code == 1 && strings.Contains(out.String(), "FAILED: error while os.Stat") {
+		t.Log("checkConfig() : Test 3 PASSED.")
+	} else {
+		t.Errorf("checkConfig() : Test 3 FAILED, exit code: %d, output: %s", code, out.String())
+	}
+
+}
+
 func TestComputeRoutePrefix(t *testing.T) {
 
 	prefixSlice := []string{
@@ -111,7 +151,7 @@ func TestReloadConfigOnReload(t *testing.T) {
 	sc := structures.NewSafeConfig(&structures.Config{})
 
 	go func() {
-		reloadConfigOnReload(sc, reload, logger)
+		reloadConfigOnReload(sc, poller.New(sc, logger), reload, logger)
 	}()
 
 	// Test 1 --------------------------------------------------------------------
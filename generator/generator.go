@@ -116,7 +116,7 @@ func main() {
 			validConfig +=
 				indent + "device_modbus_id: 1\n" +
 					indent + "device_timeout: 200ms\n" +
-					indent + "device_request_delay: 500ms\n"
+					indent + "device_request_delay: 50ms\n"
 			validConfig += indent + "device_labels:\n"
 
 			for k, v := range device.Labels {
@@ -5,7 +5,7 @@ go 1.16
 require (
 	github.com/go-kit/kit v0.10.0
 	github.com/goburrow/modbus v0.1.0
-	github.com/goburrow/serial v0.1.0 // indirect
+	github.com/goburrow/serial v0.1.0
 	github.com/prometheus/client_golang v1.11.1
 	github.com/prometheus/common v0.26.0
 	github.com/tbrandon/mbserver v0.0.0-20170611213546-993e1772cc62
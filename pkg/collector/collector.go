@@ -1,7 +1,11 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,141 +22,577 @@ type Collector struct {
 	Target   string
 	Workload map[structures.Device]structures.Registers
 	Logger   log.Logger
+	// Context of the scrape request, its deadline limits the scrape
+	Context context.Context
+	// Cache is the result of background polling, target is not scraped if set
+	Cache *CachedScrape
+
+	// Descriptors of the workload metric families (by metric name) and of the
+	// register read errors, nil unless built by NewModbusCollector
+	families   map[string]*familyDesc
+	readErrors *familyDesc
+}
+
+// CachedScrape is the result of scraping the target in background
+type CachedScrape struct {
+	Scrapes []DeviceScrape
+	// Time the scrape started at and took
+	Time     time.Time
+	Duration time.Duration
+	// Values are not exported once StaleAfter is passed since the scrape end
+	StaleAfter time.Duration
+}
+
+// DeviceScrape is the result of scraping a single device of the target
+type DeviceScrape struct {
+	Device    structures.Device
+	DataUnits []structures.DataUnit
+	// Errors of data units which cannot be read, by index in DataUnits
+	Errors map[int]error
+	// Error is set when the device cannot be read at all
+	Error error
+	// Identification objects of the device by object id, if it is read
+	Identification map[byte]string
 }
 
 // Constants declaration section -----------------------------------------------
 const (
 	tInt16 = "int16"
 	tInt32 = "int32"
+
+	// Metric types of registers, gauge is the default one
+	gaugeType   = "gauge"
+	counterType = "counter"
+	untypedType = "untyped"
+
+	defaultHelp = "Value of the MODBUS register."
+
+	// Metrics exported for failed registers (and samples)
+	readErrorsName = "modbus_register_read_errors"
+	errorName      = "modbus_error"
+
+	// Labels given to series of every target scraped by the targets page
+	TargetLabel = "target"
+	ConfigLabel = "config"
+
+	// SunSpec scale factor 0x8000 means the value is not implemented
+	notImplementedScaleFactor = -32768
+)
+
+// Variables declaration section -----------------------------------------------
+var (
+	// Names of the metrics exported by the collector itself, registers cannot
+	// be exported as them
+	reservedNames = map[string]bool{readErrorsName: true, errorName: true}
+	// Names of the labels set by the collector itself, target labels cannot
+	// be named as them
+	reservedLabels = map[string]bool{"exception_code": true, "reason": true}
+
+	// Descriptors of the metrics exported for every target
+	upDesc                  = newTargetDesc("modbus_up", "Whether the MODBUS device answers (1) or not (0).", []string{"unit_id"})
+	scrapeFailuresDesc      = newTargetDesc("modbus_scrape_failures", "Failed reads of the MODBUS device in the scrape by reason.", []string{"unit_id", "reason"})
+	scrapeSuccessDesc       = newTargetDesc("modbus_scrape_success", "Whether every register of every device is read (1) or not (0).", nil)
+	scrapeDurationDesc      = newTargetDesc("modbus_scrape_read_duration_seconds", "The time scraping target took in seconds.", nil)
+	dataUnitsReturnedDesc   = newTargetDesc("modbus_scrape_data_units_returned", "Data units returned from single scrape.", nil)
+	totalScrapeDurationDesc = newTargetDesc("modbus_total_scrape_duration_seconds", "Total MODBUS time scrape took (read and processing).", nil)
+	pollTimestampDesc       = newTargetDesc("modbus_poll_timestamp_seconds", "Time the target was last polled at, since the Epoch.", nil)
+	pollStaleDesc           = newTargetDesc("modbus_poll_stale", "Whether the polled values are too old to be exported (1) or not (0).", nil)
+
+	targetDescs = []*prometheus.Desc{
+		upDesc,
+		scrapeFailuresDesc,
+		scrapeSuccessDesc,
+		scrapeDurationDesc,
+		dataUnitsReturnedDesc,
+		totalScrapeDurationDesc,
+		pollTimestampDesc,
+		pollStaleDesc,
+		deviceInfoDesc,
+		deviceObjectInfoDesc,
+	}
 )
 
 // Functions declaration section -----------------------------------------------
 
-// NewModbusCollector returns a Modbus collector ready to use.
+// NewModbusCollector returns a Modbus collector ready to use. Descriptors of
+// every metric family of the (checked) workload are built at once, so the
+// collector is checked by the registry it is registered to.
 func NewModbusCollector(
 	Target string,
 	Workload map[structures.Device]structures.Registers,
 	Logger log.Logger,
 ) *Collector {
+
+	families, readErrors := newFamilyDescs(Workload)
+
 	return &Collector{
-		Target:   Target,
-		Workload: Workload,
-		Logger:   Logger,
+		Target:     Target,
+		Workload:   Workload,
+		Logger:     Logger,
+		families:   families,
+		readErrors: readErrors,
 	}
 }
 
-// RegisterToSamples convert registers values into native prometheus metrics
-func RegisterToSamples(metricType string, metricSiName string, value float64, labels map[string]string, logger log.Logger) ([]prometheus.Metric, error) {
+// newTargetDesc returns descriptor of the metric exported for every target,
+// its name and label names are reserved
+func newTargetDesc(name, help string, labelNames []string) *prometheus.Desc {
+
+	reservedNames[name] = true
+	for _, label := range labelNames {
+		reservedLabels[label] = true
+	}
+
+	return prometheus.NewDesc(name, help, labelNames, nil)
+}
+
+// RegisterToSamples convert registers values into native prometheus metrics of
+// the metric type (gauge by default, counter or untyped). Bitfield and enum
+// registers are converted into a sample of every state.
+func RegisterToSamples(dataUnit structures.DataUnit, logger log.Logger) ([]prometheus.Metric, error) {
 
 	var (
-		metricName     string
 		promMetricType prometheus.ValueType
 	)
 
+	promMetricType = valueType(dataUnit.MetricType)
+
+	name := metricName(dataUnit)
+	if name == "" {
+		level.Error(logger).Log(
+			"msg", "Error parsing register metric name. Will use default value 'modbus_word'",
+		)
+		name = "modbus_word"
+	}
+	help := dataUnit.Help
+	if help == "" {
+		help = defaultHelp
+	}
+
+	series := expandStates(dataUnit)
+	samples := make([]prometheus.Metric, 0, len(series))
+
+	for _, state := range series {
+
+		labelNames := make([]string, 0, len(state.Labels))
+		labelValues := make([]string, 0, len(state.Labels))
+
+		for k, v := range state.Labels {
+			labelNames = append(labelNames, k)
+			labelValues = append(labelValues, v)
+		}
+
+		level.Debug(logger).Log(
+			"metric_type", dataUnit.MetricType,
+			"metric_name", name,
+			"metric_value", state.Value,
+			"metric_labels_names", fmt.Sprint(labelNames),
+			"metric_labels_values", fmt.Sprint(labelValues),
+		)
+
+		sample, error := prometheus.NewConstMetric(
+			prometheus.NewDesc(name, help, labelNames, nil),
+			promMetricType,
+			state.Value,
+			labelValues...,
+		)
+		if error != nil {
+			sample = prometheus.NewInvalidMetric(prometheus.NewDesc(errorName, "Error calling NewConstMetric", nil, nil),
+				fmt.Errorf("Error for metric %s with labels %v - %s", name, labelValues, error.Error()))
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// valueType returns Prometheus value type of the metric type given in config
+func valueType(metricType string) prometheus.ValueType {
+
+	switch strings.ToLower(metricType) {
+	case counterType:
+		return prometheus.CounterValue
+	case untypedType:
+		return prometheus.UntypedValue
+	default:
+		return prometheus.GaugeValue
+	}
+}
+
+// metricName returns name of the metric exporting the data unit, data units
+// which are not prepared by workload are named by their si name
+func metricName(dataUnit structures.DataUnit) string {
+
+	if dataUnit.MetricName != "" || dataUnit.SiName == "" {
+		return dataUnit.MetricName
+	}
+
+	return "modbus_" + strings.ToLower(dataUnit.SiName)
+}
+
+// CheckMetricType checks metric type of the register given in config, empty
+// one means gauge
+func CheckMetricType(metricType string) error {
+
+	switch strings.ToLower(metricType) {
+	case "", gaugeType, counterType, untypedType:
+		return nil
+	default:
+		return fmt.Errorf("unsupported metric type '%s'", metricType)
+	}
+}
+
+// ScrapeTarget prepare and read workload (devices and their respective registers).
+// Devices (units) with the same transport settings are read over a single
+// connection, kept in the pool between scrapes. Scrapes of the same target are
+// queued by the scheduler, the context deadline limits the time spent waiting.
+// Error is returned only if none of the devices can be read.
+func ScrapeTarget(ctx context.Context, address string, workload map[structures.Device]structures.Registers, logger log.Logger) ([]DeviceScrape, error) {
+
+	var (
+		scrapes []DeviceScrape
+	)
+
+	for _, units := range groupUnits(workload) {
+
+		deviceAddress := targetAddress(address, units[0].Transport, logger)
+
+		done, scheduleError := master.DefaultScheduler.Schedule(ctx, deviceAddress)
+		if scheduleError != nil {
+			level.Error(logger).Log("msg", "Error scheduling scrape of device", "address", deviceAddress, "units", len(units), "err", scheduleError)
+			scrapes = append(scrapes, failedUnits(deviceAddress, units, scheduleError)...)
+			continue
+		}
+
+		connection, dialError := master.DefaultPool.Acquire(ctx, deviceAddress, units[0], logger)
+		if dialError != nil {
+			done()
+			level.Error(logger).Log("msg", "Error connecting to device", "address", deviceAddress, "units", len(units), "err", dialError)
+			scrapes = append(scrapes, failedUnits(deviceAddress, units, dialError)...)
+			continue
+		}
+
+		readErrors := make([]error, 0, len(units))
+
+		for _, unit := range units {
+
+			results, texts, readError := connection.ReadValues(ctx, unit, workload[unit], logger)
+			scrape := scrapeDevice(deviceAddress, unit, workload[unit], results, texts, readError, logger)
+			readErrors = append(readErrors, readError)
+
+			// Identification of the device which does not answer is not read
+			if unit.ReadIdentification != "" && scrape.Error == nil {
+				objects, identificationError := DefaultIdentificationCache.Identification(ctx, connection, deviceAddress, unit, logger)
+				if identificationError != nil {
+					level.Warn(logger).Log("msg", "Error reading device identification", "address", deviceAddress, "modbus_id", unit.ModbusID, "err", identificationError)
+					readErrors = append(readErrors, identificationError)
+				}
+				scrape.Identification = objects
+			}
+
+			scrapes = append(scrapes, scrape)
+		}
+
+		master.DefaultPool.Release(connection, readErrors...)
+		done()
+	}
+
+	for _, scrape := range scrapes {
+		if scrape.Error == nil {
+			return scrapes, nil
+		}
+	}
+	if len(scrapes) > 0 {
+		return scrapes, scrapes[0].Error
+	}
+
+	return scrapes, nil
+}
+
+// failedUnits returns scrapes of the units which cannot be read at all
+func failedUnits(address string, units []structures.Device, err error) []DeviceScrape {
+
+	scrapes := make([]DeviceScrape, 0, len(units))
+	for _, unit := range units {
+		scrapes = append(scrapes, DeviceScrape{
+			Device: unit,
+			Errors: make(map[int]error),
+			Error:  fmt.Errorf("Error reading remote address %s: %w", address, err),
+		})
+	}
+
+	return scrapes
+}
+
+// groupUnits groups devices (units) sharing transport settings, ordered by
+// their MODBUS IDs
+func groupUnits(workload map[structures.Device]structures.Registers) [][]structures.Device {
+
+	var (
+		groups [][]structures.Device
+	)
+
+	indexes := make(map[structures.Device]int)
+
+	for device := range workload {
+
+		// Only transport settings matter
+		key := master.TransportSettings(device)
+
+		index, ok := indexes[key]
+		if !ok {
+			index = len(groups)
+			indexes[key] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], device)
+	}
+
+	for _, units := range groups {
+		sort.Slice(units, func(i, j int) bool { return units[i].ModbusID < units[j].ModbusID })
+	}
+
+	return groups
+}
+
+// scrapeDevice converts results of reading device registers into data units
+func scrapeDevice(address string, device structures.Device, registers structures.Registers, results []float64, texts map[int]string, readError error, logger log.Logger) DeviceScrape {
+
+	var (
+		dataUnit structures.DataUnit
+	)
+
+	scrape := DeviceScrape{Device: device, Errors: make(map[int]error)}
+
+	registerErrors, partial := readError.(master.RegisterErrors)
+	if readError != nil && !partial {
+		level.Error(logger).Log("msg", "Error reading device", "address", address, "modbus_id", device.ModbusID, "err", readError)
+		scrape.Error = fmt.Errorf("Error reading remote address %s: %w", address, readError)
+		return scrape
+	}
+
+	// Scale factors are read along with the registers, collect them first
+	scaleFactors := make(map[string]float64)
+	scaleFactorErrors := make(map[string]error)
+	for each, register := range registers {
+		if register.Internal {
+			scaleFactors[register.SiName] = results[each]
+			switch {
+			case registerErrors[each] != nil:
+				scaleFactorErrors[register.SiName] = registerErrors[each]
+			case results[each] == notImplementedScaleFactor:
+				scaleFactorErrors[register.SiName] = master.ErrNotImplemented
+			}
+		}
+	}
+
+	for each, register := range registers {
+
+		if register.Internal {
+			continue
+		}
+
+		dataUnit = register
+		dataUnit.Value = engineeringValue(register, results[each], scaleFactors)
+		dataUnit.Text = texts[each]
+
+		switch {
+		case registerErrors[each] != nil:
+			scrape.Errors[len(scrape.DataUnits)] = registerErrors[each]
+		case scaleFactorErrors[register.ScaleFactor] != nil:
+			scrape.Errors[len(scrape.DataUnits)] = fmt.Errorf("scale factor cannot be read: %w", scaleFactorErrors[register.ScaleFactor])
+		}
+
+		level.Debug(logger).Log(
+			"data_unit_value", dataUnit.Value,
+			"data_unit_si_name", dataUnit.SiName,
+			"data_unit_type", dataUnit.Type,
+			"data_unit_byte_order", dataUnit.ByteOrder,
+			"data_unit_labels", fmt.Sprint(dataUnit.Labels),
+		)
+
+		scrape.DataUnits = append(scrape.DataUnits, dataUnit)
+	}
+
+	return scrape
+}
+
+// Up reports whether the device answers: it is readable and either at least one
+// of its registers is read or the device replies with MODBUS exceptions
+func (scrape DeviceScrape) Up() bool {
+
+	if scrape.Error != nil {
+		return false
+	}
+	if len(scrape.Errors) < len(scrape.DataUnits) || len(scrape.DataUnits) == 0 {
+		return true
+	}
+	for _, readError := range scrape.Errors {
+		if _, ok := master.ExceptionCode(readError); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// engineeringValue converts raw register value into engineering units, i.e.
+// value * scale * 10^scale_factor + offset
+func engineeringValue(register structures.DataUnit, value float64, scaleFactors map[string]float64) float64 {
+
+	if register.Scale != 0 {
+		value *= register.Scale
+	}
+	if register.ScaleFactor != "" {
+		// Dividing keeps e.g. 2301 * 10^-1 exactly 230.1
+		if exponent := int(scaleFactors[register.ScaleFactor]); exponent < 0 {
+			value /= math.Pow10(-exponent)
+		} else {
+			value *= math.Pow10(exponent)
+		}
+	}
+
+	return value + register.Offset
+}
+
+// Failures counts failed reads of the device by reason, failure to read the
+// device at all is counted once
+func (scrape DeviceScrape) Failures() map[string]int {
+
+	failures := make(map[string]int)
+
+	if scrape.Error != nil {
+		failures[master.FailureReason(scrape.Error)]++
+		return failures
+	}
+	for _, readError := range scrape.Errors {
+		failures[master.FailureReason(readError)]++
+	}
+
+	return failures
+}
+
+// registerErrorSample returns sample of the register read error, labelled by
+// register labels, failure reason and exception code ('none' unless the device
+// replied with MODBUS exception)
+func registerErrorSample(labels map[string]string, readError error) prometheus.Metric {
+
 	labelNames := make([]string, 0, len(labels)+1)
 	labelValues := make([]string, 0, len(labels)+1)
 
 	for k, v := range labels {
+		if k == "exception_code" || k == "reason" {
+			continue
+		}
 		labelNames = append(labelNames, k)
 		labelValues = append(labelValues, v)
 	}
 
-	switch metricType {
-	case "counter":
-		promMetricType = prometheus.CounterValue
-	// case "word", "dword":
-	// 	promMetricType = prometheus.GaugeValue
-	// case "uint16", "uint32":
-	// 	promMetricType = prometheus.GaugeValue
-	// case "int16", "int32":
-	// 	promMetricType = prometheus.GaugeValue
-	default:
-		promMetricType = prometheus.GaugeValue
+	exceptionCode := "none"
+	if code, ok := master.ExceptionCode(readError); ok {
+		exceptionCode = strconv.Itoa(int(code))
 	}
-
-	if metricSiName != "" {
-		metricName = "modbus_" + strings.ToLower(metricSiName)
-	} else {
-		level.Error(logger).Log(
-			"msg", "Error parsing register si name. Will use default value 'word'",
-		)
-		metricName = "modbus_word"
-	}
-	level.Debug(logger).Log(
-		"metric_type", metricType,
-		"metric_si_name", metricSiName,
-		"metric_name", metricName,
-		"metric_value", value,
-		"metric_labels_names", fmt.Sprint(labelNames),
-		"metric_labels_values", fmt.Sprint(labelValues),
-	)
+	labelNames = append(labelNames, "exception_code", "reason")
+	labelValues = append(labelValues, exceptionCode, master.FailureReason(readError))
 
 	sample, error := prometheus.NewConstMetric(
-		prometheus.NewDesc(metricName, "metric.Help", labelNames, nil),
-		promMetricType,
-		value,
+		prometheus.NewDesc(readErrorsName, "Registers which cannot be read in the scrape.", labelNames, nil),
+		prometheus.GaugeValue,
+		1,
 		labelValues...,
 	)
 	if error != nil {
-		sample = prometheus.NewInvalidMetric(prometheus.NewDesc("modbus_error", "Error calling NewConstMetric", nil, nil),
-			fmt.Errorf("Error for metric %s with labels %v - %s", metricName, labelValues, error.Error()))
+		sample = prometheus.NewInvalidMetric(prometheus.NewDesc(errorName, "Error calling NewConstMetric", nil, nil), error)
 	}
 
-	return []prometheus.Metric{sample}, nil
+	return sample
 }
 
-// ScrapeTarget prepare and read workload (devices and their respective registers)
-func ScrapeTarget(address string, workload map[structures.Device]structures.Registers, logger log.Logger) ([]structures.DataUnit, error) {
+// targetAddress completes the scrape target with the default MODBUS TCP port,
+// serial transports use the target (e.g. '/dev/ttyUSB0') as is
+func targetAddress(address string, transport string, logger log.Logger) string {
 
-	var (
-		error     error
-		addrSlice []string
-		results   []float64
-
-		dataUnits []structures.DataUnit
-		dataUnit  structures.DataUnit
-	)
+	if master.IsSerialTransport(transport) {
+		return address
+	}
 
-	addrSlice = strings.Split(address, ":")
+	addrSlice := strings.Split(address, ":")
 	if len(addrSlice) < 2 {
 		address = addrSlice[0] + ":502"
 		level.Warn(logger).Log("msg", "Cannot find address port, using default '502'", "new_address", address)
 	}
 
-	for parameters, registers := range workload {
+	return address
+}
 
-		results, error = master.ReadRemote(address, parameters, registers, logger)
-		if error != nil {
-			return nil, fmt.Errorf("Error reading remote address %s: %s", address, error.Error())
-		}
+// Describe implements Prometheus.Collector, collectors which are not built by
+// NewModbusCollector describe nothing (i.e. they are unchecked)
+func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
 
-		for each, register := range registers {
+	if collector.families == nil {
+		return
+	}
 
-			dataUnit = register
-			dataUnit.Value = results[each]
+	for _, desc := range targetDescs {
+		ch <- desc
+	}
+	for _, metricFamily := range collector.families {
+		ch <- metricFamily.desc
+	}
+	ch <- collector.readErrors.desc
+}
 
-			level.Debug(logger).Log(
-				"data_unit_value", dataUnit.Value,
-				"data_unit_si_name", dataUnit.SiName,
-				"data_unit_type", dataUnit.Type,
-				"data_unit_byte_order", dataUnit.ByteOrder,
-				"data_unit_labels", fmt.Sprint(dataUnit.Labels),
-			)
+// registerSample returns samples of the data unit, using descriptor of its
+// metric family
+func (collector *Collector) registerSample(dataUnit structures.DataUnit) ([]prometheus.Metric, error) {
 
-			dataUnits = append(dataUnits, dataUnit)
-		}
+	name := metricName(dataUnit)
 
+	metricFamily, ok := collector.families[name]
+	if !ok {
+		return RegisterToSamples(dataUnit, collector.Logger)
 	}
 
-	return dataUnits, nil
+	series := expandStates(dataUnit)
+	samples := make([]prometheus.Metric, 0, len(series))
+
+	for _, state := range series {
+		sample, error := prometheus.NewConstMetric(metricFamily.desc, metricFamily.valueType, state.Value, metricFamily.labelValues(state.Labels)...)
+		if error != nil {
+			sample = prometheus.NewInvalidMetric(prometheus.NewDesc(errorName, "Error calling NewConstMetric", nil, nil),
+				fmt.Errorf("Error for metric %s with labels %v - %s", name, state.Labels, error.Error()))
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
 }
 
-// Describe implements Prometheus.Collector
-func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
+// readErrorSample returns sample of the register read error, using descriptor
+// of the read errors
+func (collector *Collector) readErrorSample(labels map[string]string, readError error) prometheus.Metric {
 
-	// prometheus.DescribeByCollect(collector, ch)
-	// ch <- prometheus.NewDesc("dummy", "dummy", nil, nil)
+	if collector.readErrors == nil {
+		return registerErrorSample(labels, readError)
+	}
+
+	exceptionCode := "none"
+	if code, ok := master.ExceptionCode(readError); ok {
+		exceptionCode = strconv.Itoa(int(code))
+	}
 
+	sample, error := prometheus.NewConstMetric(
+		collector.readErrors.desc,
+		collector.readErrors.valueType,
+		1,
+		collector.readErrors.labelValues(labels, exceptionCode, master.FailureReason(readError))...,
+	)
+	if error != nil {
+		sample = prometheus.NewInvalidMetric(prometheus.NewDesc(errorName, "Error calling NewConstMetric", nil, nil), error)
+	}
+
+	return sample
 }
 
 // Collect implements Prometheus.Collector
@@ -162,57 +602,166 @@ func (collector *Collector) Collect(ch chan<- prometheus.Metric) {
 
 	var (
 		samples []prometheus.Metric
+		error   error
+
+		scrapes   []DeviceScrape
+		duration  time.Duration
+		timestamp time.Time
+		stale     bool
 	)
 
 	logger := collector.Logger
 
-	// Target scraping
-	data, error := ScrapeTarget(collector.Target, collector.Workload, logger)
-	if error != nil {
-		level.Error(logger).Log("msg", "ScrapeTarget() collide with an error", "target", collector.Target, "error", error.Error())
-		ch <- prometheus.NewInvalidMetric(
-			prometheus.NewDesc("modbus_error", "Error scraping target", nil, nil),
-			error,
+	if collector.Cache != nil {
+
+		scrapes = collector.Cache.Scrapes
+		duration = collector.Cache.Duration
+		timestamp = collector.Cache.Time
+
+		age := time.Since(timestamp.Add(duration))
+		stale = collector.Cache.StaleAfter > 0 && age > collector.Cache.StaleAfter
+		if stale {
+			level.Warn(logger).Log("msg", "Polled values are stale", "target", collector.Target, "age", age)
+		}
+
+		stale01 := 0.0
+		if stale {
+			stale01 = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			pollTimestampDesc,
+			prometheus.GaugeValue,
+			float64(timestamp.UnixNano())/1e9,
 		)
-		return
+		ch <- prometheus.MustNewConstMetric(
+			pollStaleDesc,
+			prometheus.GaugeValue,
+			stale01,
+		)
+
+	} else {
+
+		ctx := collector.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		// Target scraping
+		scrapes, error = ScrapeTarget(ctx, collector.Target, collector.Workload, logger)
+		if error != nil {
+			// Failed scrape is reported by modbus_up and modbus_scrape_success
+			level.Error(logger).Log("msg", "ScrapeTarget() collide with an error", "target", collector.Target, "error", error.Error())
+		}
+		duration = time.Since(start)
+	}
+
+	// Values of polled target are exported with the time they were read at
+	sample := func(metric prometheus.Metric) prometheus.Metric {
+		if timestamp.IsZero() {
+			return metric
+		}
+		return prometheus.NewMetricWithTimestamp(timestamp, metric)
+	}
+
+	returned := 0
+	for _, scrape := range scrapes {
+		if !stale {
+			returned += len(scrape.DataUnits) - len(scrape.Errors)
+		}
 	}
 
 	// Self metrics --------------------------------------------------------------
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("modbus_scrape_read_duration_seconds", "The time scraping target took in seconds.", nil, nil),
+		scrapeDurationDesc,
 		prometheus.GaugeValue,
-		float64(time.Since(start).Seconds()),
+		duration.Seconds(),
 	)
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("modbus_scrape_data_units_returned", "Data units returned from single scrape.", nil, nil),
+		dataUnitsReturnedDesc,
 		prometheus.GaugeValue,
-		float64(len(data)),
+		float64(returned),
 	)
 
 	// ---------------------------------------------------------------------------
 
-	// Call RegisterToSamples for each received data unit after ScrapeTarget
-	for _, dataUnits := range data {
+	success := 1.0
 
-		samples, error = RegisterToSamples(dataUnits.Type, dataUnits.SiName, dataUnits.Value, dataUnits.Labels, logger)
-		if error != nil {
-			level.Error(logger).Log("msg", "RegisterToSamples() collide with error while creating samples", "error", error.Error())
-			ch <- prometheus.NewInvalidMetric(
-				prometheus.NewDesc("modbus_error", "Error sampling registers", nil, nil),
-				error,
+	for _, scrape := range scrapes {
+
+		unitID := strconv.Itoa(int(scrape.Device.ModbusID))
+
+		up := 0.0
+		if scrape.Up() {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			upDesc,
+			prometheus.GaugeValue,
+			up,
+			unitID,
+		)
+
+		failures := scrape.Failures()
+		for _, reason := range master.FailureReasons {
+			if failures[reason] > 0 {
+				success = 0
+			}
+			ch <- prometheus.MustNewConstMetric(
+				scrapeFailuresDesc,
+				prometheus.GaugeValue,
+				float64(failures[reason]),
+				unitID,
+				reason,
 			)
-			return
 		}
-		// All ready samples to channel
-		for _, sample := range samples {
-			ch <- sample
+
+		if stale {
+			success = 0
+			continue
 		}
 
+		for _, info := range identificationSamples(unitID, scrape.Identification) {
+			ch <- sample(info)
+		}
+
+		// Sample each received data unit after ScrapeTarget
+		for each, dataUnits := range scrape.DataUnits {
+
+			if readError, failed := scrape.Errors[each]; failed {
+				level.Warn(logger).Log("msg", "Register cannot be read", "labels", fmt.Sprint(dataUnits.Labels), "error", readError.Error())
+				ch <- sample(collector.readErrorSample(dataUnits.Labels, readError))
+				continue
+			}
+
+			samples, error = collector.registerSample(dataUnits)
+			if error != nil {
+				level.Error(logger).Log("msg", "RegisterToSamples() collide with error while creating samples", "error", error.Error())
+				ch <- prometheus.NewInvalidMetric(
+					prometheus.NewDesc(errorName, "Error sampling registers", nil, nil),
+					error,
+				)
+				return
+			}
+			// All ready samples to channel
+			for _, each := range samples {
+				ch <- sample(each)
+			}
+
+		}
+	}
+
+	if len(scrapes) == 0 {
+		success = 0
 	}
+	ch <- prometheus.MustNewConstMetric(
+		scrapeSuccessDesc,
+		prometheus.GaugeValue,
+		success,
+	)
 
 	// Self metric ---------------------------------------------------------------
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("modbus_total_scrape_duration_seconds", "Total MODBUS time scrape took (read and processing).", nil, nil),
+		totalScrapeDurationDesc,
 		prometheus.GaugeValue,
 		float64(time.Since(start).Seconds()),
 	)
@@ -1,11 +1,15 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/NobleD5/modbus_exporter/pkg/master"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
 	"github.com/go-kit/kit/log"
@@ -23,6 +27,19 @@ type Set struct {
 	Labels       map[string]string
 }
 
+// samplesCollector collects the samples as they are
+type samplesCollector []prometheus.Metric
+
+func (samples samplesCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(samples, ch)
+}
+
+func (samples samplesCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range samples {
+		ch <- sample
+	}
+}
+
 const (
 	validTarget   = "localhost:1902"
 	invalidTarget = "loc.AA"
@@ -86,10 +103,12 @@ func TestRegisterToSamples(t *testing.T) {
 		set := set
 
 		samples, err := RegisterToSamples(
-			set.MetricType,
-			set.MetricSiName,
-			set.Value,
-			set.Labels,
+			structures.DataUnit{
+				MetricType: set.MetricType,
+				SiName:     set.MetricSiName,
+				Value:      set.Value,
+				Labels:     set.Labels,
+			},
 			logger,
 		)
 		if err != nil {
@@ -102,12 +121,50 @@ func TestRegisterToSamples(t *testing.T) {
 
 }
 
+func TestRegisterToSamplesTyped(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	testCases := []struct {
+		metricType, help string
+		awaiting         string
+	}{
+		{"counter", "Energy imported.", "# HELP energy_wh_total Energy imported.\n# TYPE energy_wh_total counter\nenergy_wh_total{phase=\"A\"} 12\n"},
+		{"untyped", "", "# HELP energy_wh_total Value of the MODBUS register.\n# TYPE energy_wh_total untyped\nenergy_wh_total{phase=\"A\"} 12\n"},
+		{"", "", "# HELP energy_wh_total Value of the MODBUS register.\n# TYPE energy_wh_total gauge\nenergy_wh_total{phase=\"A\"} 12\n"},
+	}
+
+	for each, testCase := range testCases {
+
+		dataUnit := structures.DataUnit{
+			MetricName: "energy_wh_total",
+			MetricType: testCase.metricType,
+			Help:       testCase.help,
+			Value:      12,
+			Labels:     map[string]string{"phase": "A"},
+		}
+
+		samples, err := RegisterToSamples(dataUnit, logger)
+		if err != nil {
+			t.Fatalf("RegisterToSamples() : Typed Test %d FAILED, %s", each+1, err)
+		}
+
+		if err := testutil.CollectAndCompare(samplesCollector(samples), strings.NewReader(testCase.awaiting)); err == nil {
+			t.Logf("RegisterToSamples() : Typed Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("RegisterToSamples() : Typed Test %d FAILED, %s", each+1, err)
+		}
+	}
+
+}
+
 func TestScrapeTarget(t *testing.T) {
 
 	logger := log.NewLogfmtLogger(os.Stdout)
 	logger = level.NewFilter(logger, level.AllowDebug())
 
-	validDevice := structures.NewDevice(1, "1000ms", "3000ms", true)
+	validDevice := structures.NewDevice(1, "1000ms", "0s", true)
 
 	validDataUnitA := structures.NewDataUnit(
 		map[string]uint16{"dec": uint16(331)},
@@ -130,7 +187,7 @@ func TestScrapeTarget(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: Scrape valid target
 	// ---------------------------------------------------------------------------
-	data, err := ScrapeTarget(validTarget, validWorkload, logger)
+	data, err := ScrapeTarget(context.Background(), validTarget, validWorkload, logger)
 	if err != nil {
 		t.Errorf("ScrapeTarget() : Test 1 FAILED, %s", err)
 		t.Logf("Data unit is: %v\n", data)
@@ -141,7 +198,7 @@ func TestScrapeTarget(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: Scrape invalid target
 	// ---------------------------------------------------------------------------
-	_, err = ScrapeTarget(invalidTarget, validWorkload, logger)
+	_, err = ScrapeTarget(context.Background(), invalidTarget, validWorkload, logger)
 	if err == nil {
 		t.Errorf("ScrapeTarget() : Test 2 FAILED, %s", err)
 	} else {
@@ -155,7 +212,7 @@ func TestCollector(t *testing.T) {
 	logger := log.NewLogfmtLogger(os.Stdout)
 	logger = level.NewFilter(logger, level.AllowDebug())
 
-	validDevice := structures.NewDevice(1, "1000ms", "3000ms", true)
+	validDevice := structures.NewDevice(1, "1000ms", "0s", true)
 
 	validDataUnitA := structures.NewDataUnit(
 		map[string]uint16{"dec": uint16(257)},
@@ -207,11 +264,20 @@ func TestCollector(t *testing.T) {
 	)
 
 	registry.MustRegister(collectorA)
-	registry.MustRegister(collectorB)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: Register collector of the conflicting metric family
+	// ---------------------------------------------------------------------------
+	err := registry.Register(collectorB)
+	if err != nil {
+		t.Logf("Register() : Test 1 PASSED, %s", err)
+	} else {
+		t.Error("Register() : Test 1 FAILED, labels of 'modbus_temperature' conflict")
+	}
 
 	s := strings.NewReader(
-		"# HELP modbus_bool metric.Help\n# TYPE modbus_bool gauge\nmodbus_bool{device=\"PLC\",protocol=\"MODBUS\",register_name=\"QF1\",register_type=\"word\",vendor=\"WAGO\"} 0\n\n" +
-			"# HELP modbus_temperature metric.Help\n# TYPE modbus_temperature gauge\nmodbus_temperature{device=\"PLC\",protocol=\"MODBUS\",register_name=\"TR01_T\",register_type=\"int16\",vendor=\"WAGO\"} 0\n\n" +
+		"# HELP modbus_bool Value of the MODBUS register.\n# TYPE modbus_bool gauge\nmodbus_bool{device=\"PLC\",protocol=\"MODBUS\",register_name=\"QF1\",register_type=\"word\",vendor=\"WAGO\"} 0\n\n" +
+			"# HELP modbus_temperature Value of the MODBUS register.\n# TYPE modbus_temperature gauge\nmodbus_temperature{device=\"PLC\",protocol=\"MODBUS\",register_name=\"TR01_T\",register_type=\"int16\",vendor=\"WAGO\"} 0\n\n" +
 			"modbus_temperature{device=\"PLC\",prompt=\"Температура ангара\",register_name=\"TR02_T\",register_type=\"int16\",vendor=\"WAGO\"} 0\n\n",
 	)
 	r := io.LimitReader(s, 1000)
@@ -229,7 +295,7 @@ func TestCollector(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: CollectAndCompare
 	// ---------------------------------------------------------------------------
-	err := testutil.CollectAndCompare(collectorB, r)
+	err = testutil.CollectAndCompare(collectorB, r)
 	if err != nil {
 		t.Log("CollectAndCompare() : Test 2 PASSED.")
 	} else {
@@ -237,3 +303,379 @@ func TestCollector(t *testing.T) {
 	}
 
 }
+
+func TestDescribe(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+
+	voltageA := structures.NewDataUnit(map[string]uint16{"U_A": 300}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_A", "phase": "A"})
+	voltageAB := structures.NewDataUnit(map[string]uint16{"U_AB": 301}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_AB", "phase": "AB"})
+	energy := structures.NewDataUnit(map[string]uint16{"E": 302}, 0, "energy", "uint32", "", "", "FC3", map[string]string{"register_name": "E"})
+	energy.MetricType = "counter"
+
+	workload := map[structures.Device]structures.Registers{
+		*device: structures.Registers{*voltageA, *voltageAB, *energy},
+	}
+
+	describe := func(collector prometheus.Collector) []string {
+		ch := make(chan *prometheus.Desc, 32)
+		collector.Describe(ch)
+		close(ch)
+		var descs []string
+		for desc := range ch {
+			descs = append(descs, desc.String())
+		}
+		return descs
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: descriptor of every metric family, read errors and target metrics
+	// ---------------------------------------------------------------------------
+	descs := strings.Join(describe(NewModbusCollector(validTarget, workload, logger)), "\n")
+
+	awaiting := []string{
+		`fqName: "modbus_voltage", help: "Value of the MODBUS register.", constLabels: {}, variableLabels: [phase register_name]`,
+		`fqName: "modbus_energy", help: "Value of the MODBUS register.", constLabels: {}, variableLabels: [register_name]`,
+		`fqName: "modbus_register_read_errors", help: "Registers which cannot be read in the scrape.", constLabels: {}, variableLabels: [phase register_name exception_code reason]`,
+		`fqName: "modbus_up"`,
+		`fqName: "modbus_total_scrape_duration_seconds"`,
+	}
+	passed := true
+	for _, desc := range awaiting {
+		passed = passed && strings.Contains(descs, desc)
+	}
+	if passed {
+		t.Log("Describe() : Test 1 PASSED.")
+	} else {
+		t.Errorf("Describe() : Test 1 FAILED, got: %s", descs)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: collector which is not built by NewModbusCollector is unchecked
+	// ---------------------------------------------------------------------------
+	if descs := describe(&Collector{Target: validTarget, Workload: workload, Logger: logger}); len(descs) == 0 {
+		t.Log("Describe() : Test 2 PASSED.")
+	} else {
+		t.Errorf("Describe() : Test 2 FAILED, got: %v", descs)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: malformed metric fails registration rather than the scrape
+	// ---------------------------------------------------------------------------
+	invalid := *energy
+	invalid.MetricName = "modbus energy"
+	invalidWorkload := map[structures.Device]structures.Registers{
+		*device: structures.Registers{invalid},
+	}
+
+	err := prometheus.NewRegistry().Register(NewModbusCollector(validTarget, invalidWorkload, logger))
+	if err != nil && strings.Contains(err.Error(), "modbus energy") {
+		t.Logf("Describe() : Test 3 PASSED, %s", err)
+	} else {
+		t.Errorf("Describe() : Test 3 FAILED, awaiting registration error, got: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: counter family is collected by checked collector
+	// ---------------------------------------------------------------------------
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1910"); err != nil {
+		t.Fatalf("Describe() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[302] = 1
+	serv.HoldingRegisters[303] = 2
+
+	expected := `# HELP modbus_energy Value of the MODBUS register.
+# TYPE modbus_energy counter
+modbus_energy{register_name="E"} 65538
+`
+	err = testutil.CollectAndCompare(NewModbusCollector("localhost:1910", workload, logger), strings.NewReader(expected), "modbus_energy")
+	if err == nil {
+		t.Log("Describe() : Test 4 PASSED.")
+	} else {
+		t.Errorf("Describe() : Test 4 FAILED, %s", err)
+	}
+
+}
+
+func TestEngineeringValue(t *testing.T) {
+
+	scaleFactors := map[string]float64{"sf_minus": -1, "sf_plus": 2}
+
+	dataSets := []struct {
+		register structures.DataUnit
+		value    float64
+		awaiting float64
+	}{
+		{structures.DataUnit{}, 2301, 2301},
+		{structures.DataUnit{ScaleFactor: "sf_minus"}, 2301, 230.1},
+		{structures.DataUnit{ScaleFactor: "sf_plus"}, 23, 2300},
+		{structures.DataUnit{Scale: 0.5, Offset: -40}, 100, 10},
+		{structures.DataUnit{Scale: 2, Offset: 1, ScaleFactor: "sf_minus"}, 50, 11},
+		{structures.DataUnit{Offset: 273.15}, 0, 273.15},
+	}
+
+	for each, set := range dataSets {
+		r := engineeringValue(set.register, set.value, scaleFactors)
+		if r == set.awaiting {
+			t.Logf("engineeringValue() : Test %d PASSED, expecting %f and got %f", each+1, set.awaiting, r)
+		} else {
+			t.Errorf("engineeringValue() : Test %d FAILED, expecting %f, got %f", each+1, set.awaiting, r)
+		}
+	}
+
+}
+
+func TestScrapeTargetScaleFactor(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1903"); err != nil {
+		t.Fatalf("ScrapeTarget() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[100] = 2301  // 230.1 V
+	serv.HoldingRegisters[101] = 65535 // scale factor -1
+	serv.HoldingRegisters[102] = 1234  // 12.34 A
+
+	voltage := structures.NewDataUnit(map[string]uint16{"voltage": 100}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{})
+	voltage.ScaleFactor = "scale_factor_fc3_101"
+
+	current := structures.NewDataUnit(map[string]uint16{"current": 102}, 0, "current", "uint16", "", "", "FC3", map[string]string{})
+	current.Scale = 0.01
+
+	scaleFactor := structures.NewDataUnit(map[string]uint16{"scale_factor_fc3_101": 101}, 0, "scale_factor_fc3_101", "int16", "", "", "FC3", nil)
+	scaleFactor.Internal = true
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+	workload := map[structures.Device]structures.Registers{
+		*device: structures.Registers{*voltage, *current, *scaleFactor},
+	}
+
+	data, err := ScrapeTarget(context.Background(), "localhost:1903", workload, logger)
+	if err == nil && len(data) == 1 && len(data[0].DataUnits) == 2 && len(data[0].Errors) == 0 &&
+		data[0].DataUnits[0].Value == 230.1 && data[0].DataUnits[1].Value == 12.34 {
+		t.Log("ScrapeTarget() : scale factor Test 1 PASSED.")
+	} else {
+		t.Errorf("ScrapeTarget() : scale factor Test 1 FAILED, data: %v, error: %v", data, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: SunSpec 'not implemented' scale factor fails its registers
+	// ---------------------------------------------------------------------------
+	serv.HoldingRegisters[101] = 0x8000
+
+	data, err = ScrapeTarget(context.Background(), "localhost:1903", workload, logger)
+	if err == nil && len(data) == 1 && len(data[0].Errors) == 1 && errors.Is(data[0].Errors[0], master.ErrNotImplemented) &&
+		master.FailureReason(data[0].Errors[0]) == master.ReasonDecode && data[0].DataUnits[1].Value == 12.34 {
+		t.Log("ScrapeTarget() : scale factor Test 2 PASSED.")
+	} else {
+		t.Errorf("ScrapeTarget() : scale factor Test 2 FAILED, data: %v, error: %v", data, err)
+	}
+
+}
+
+func TestCollectorPartial(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	// Holding register 500 does not exist on this device
+	serv := mbserver.NewServer()
+	serv.RegisterFunctionHandler(3, func(s *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		data := frame.GetData()
+		address, quantity := int(data[0])<<8|int(data[1]), int(data[2])<<8|int(data[3])
+		if address <= 500 && address+quantity > 500 {
+			return []byte{}, &mbserver.IllegalDataAddress
+		}
+		return mbserver.ReadHoldingRegisters(s, frame)
+	})
+	if err := serv.ListenTCP("localhost:1904"); err != nil {
+		t.Fatalf("Collect() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[499] = 2301
+	serv.HoldingRegisters[501] = 65535 // scale factor -1
+
+	registers := structures.Registers{
+		*structures.NewDataUnit(map[string]uint16{"U_A": 499}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_A"}),
+		*structures.NewDataUnit(map[string]uint16{"U_B": 500}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_B"}),
+		*structures.NewDataUnit(map[string]uint16{"U_C": 502}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_C"}),
+		*structures.NewDataUnit(map[string]uint16{"scale_factor_fc3_500": 500}, 0, "scale_factor_fc3_500", "int16", "", "", "FC3", nil),
+	}
+	registers[2].ScaleFactor = "scale_factor_fc3_500"
+	registers[3].Internal = true
+
+	device := structures.NewDevice(7, "1000ms", "0s", false)
+	collector := NewModbusCollector("localhost:1904", map[structures.Device]structures.Registers{*device: registers}, logger)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: readable registers are exported, failed ones are counted as errors
+	// ---------------------------------------------------------------------------
+	expected := `# HELP modbus_register_read_errors Registers which cannot be read in the scrape.
+# TYPE modbus_register_read_errors gauge
+modbus_register_read_errors{exception_code="2",reason="exception",register_name="U_B"} 1
+modbus_register_read_errors{exception_code="2",reason="exception",register_name="U_C"} 1
+# HELP modbus_up Whether the MODBUS device answers (1) or not (0).
+# TYPE modbus_up gauge
+modbus_up{unit_id="7"} 1
+# HELP modbus_voltage Value of the MODBUS register.
+# TYPE modbus_voltage gauge
+modbus_voltage{register_name="U_A"} 2301
+`
+	expected += `# HELP modbus_scrape_success Whether every register of every device is read (1) or not (0).
+# TYPE modbus_scrape_success gauge
+modbus_scrape_success 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "modbus_register_read_errors", "modbus_up", "modbus_voltage", "modbus_scrape_success")
+	if err == nil {
+		t.Log("Collect() : Partial Test 1 PASSED.")
+	} else {
+		t.Errorf("Collect() : Partial Test 1 FAILED, %s", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device which does not answer at all is down
+	// ---------------------------------------------------------------------------
+	scrape := DeviceScrape{DataUnits: registers[:1], Errors: map[int]error{0: errors.New("i/o timeout")}}
+	if !scrape.Up() && !(DeviceScrape{Error: errors.New("connection refused")}).Up() {
+		t.Log("Collect() : Partial Test 2 PASSED.")
+	} else {
+		t.Error("Collect() : Partial Test 2 FAILED, awaiting device down")
+	}
+
+}
+
+func TestCollectorDown(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	registers := structures.Registers{
+		*structures.NewDataUnit(map[string]uint16{"U_A": 499}, 0, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_A"}),
+	}
+	device := structures.NewDevice(3, "200ms", "0s", false)
+
+	// Nothing listens on the port
+	collector := NewModbusCollector("localhost:1905", map[structures.Device]structures.Registers{*device: registers}, logger)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: unreachable device is reported by metrics, not by invalid metric
+	// ---------------------------------------------------------------------------
+	expected := `# HELP modbus_scrape_failures Failed reads of the MODBUS device in the scrape by reason.
+# TYPE modbus_scrape_failures gauge
+modbus_scrape_failures{reason="connect",unit_id="3"} 1
+modbus_scrape_failures{reason="decode",unit_id="3"} 0
+modbus_scrape_failures{reason="exception",unit_id="3"} 0
+modbus_scrape_failures{reason="other",unit_id="3"} 0
+modbus_scrape_failures{reason="timeout",unit_id="3"} 0
+# HELP modbus_scrape_success Whether every register of every device is read (1) or not (0).
+# TYPE modbus_scrape_success gauge
+modbus_scrape_success 0
+# HELP modbus_up Whether the MODBUS device answers (1) or not (0).
+# TYPE modbus_up gauge
+modbus_up{unit_id="3"} 0
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "modbus_scrape_failures", "modbus_scrape_success", "modbus_up")
+	if err == nil {
+		t.Log("Collect() : Down Test 1 PASSED.")
+	} else {
+		t.Errorf("Collect() : Down Test 1 FAILED, %s", err)
+	}
+
+}
+
+func TestGroupUnits(t *testing.T) {
+
+	rtu := *structures.NewDevice(1, "500ms", "0s", false)
+	rtu.Transport = "rtuovertcp"
+
+	workload := make(map[structures.Device]structures.Registers)
+	for _, id := range []byte{30, 2, 1} {
+		unit := rtu
+		unit.ModbusID = id
+		unit.MaxGap = uint16(id) // register settings do not split the group
+		workload[unit] = structures.Registers{}
+	}
+
+	tcp := *structures.NewDevice(5, "500ms", "0s", false)
+	workload[tcp] = structures.Registers{}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: units with the same transport settings are grouped
+	// ---------------------------------------------------------------------------
+	groups := groupUnits(workload)
+
+	ids := make(map[int][]byte)
+	for _, units := range groups {
+		for _, unit := range units {
+			ids[len(units)] = append(ids[len(units)], unit.ModbusID)
+		}
+	}
+
+	if len(groups) == 2 && string(ids[3]) == string([]byte{1, 2, 30}) && string(ids[1]) == string([]byte{5}) {
+		t.Log("groupUnits() : Test 1 PASSED.")
+	} else {
+		t.Errorf("groupUnits() : Test 1 FAILED, groups: %v", groups)
+	}
+
+}
+
+func TestCollectorCached(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	registers := structures.Registers{
+		*structures.NewDataUnit(map[string]uint16{"U_A": 499}, 2301, "voltage", "uint16", "", "", "FC3", map[string]string{"register_name": "U_A"}),
+	}
+	device := structures.NewDevice(3, "200ms", "0s", false)
+
+	// Nothing listens on the port, cached values are served without scraping
+	collector := NewModbusCollector("localhost:1906", map[structures.Device]structures.Registers{*device: registers}, logger)
+
+	for each, testCase := range []struct {
+		age    time.Duration
+		stale  string
+		values int
+	}{
+		{time.Second, "0", 1},
+		{time.Minute, "1", 0},
+	} {
+
+		collector.Cache = &CachedScrape{
+			Scrapes:    []DeviceScrape{{Device: *device, DataUnits: registers, Errors: map[int]error{}}},
+			Time:       time.Now().Add(-testCase.age),
+			Duration:   100 * time.Millisecond,
+			StaleAfter: 10 * time.Second,
+		}
+
+		// ---------------------------------------------------------------------------
+		//  CASE: values are exported unless they are stale
+		// ---------------------------------------------------------------------------
+		expected := `# HELP modbus_poll_stale Whether the polled values are too old to be exported (1) or not (0).
+# TYPE modbus_poll_stale gauge
+modbus_poll_stale ` + testCase.stale + `
+# HELP modbus_up Whether the MODBUS device answers (1) or not (0).
+# TYPE modbus_up gauge
+modbus_up{unit_id="3"} 1
+`
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "modbus_poll_stale", "modbus_up")
+		values := testutil.CollectAndCount(collector, "modbus_voltage")
+		if err == nil && values == testCase.values {
+			t.Logf("Collect() : Cached Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("Collect() : Cached Test %d FAILED, values: %d, error: %v", each+1, values, err)
+		}
+	}
+
+}
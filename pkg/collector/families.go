@@ -0,0 +1,295 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// Family is a metric exported for one or more registers of the workload
+type Family struct {
+	Name, Help, MetricType string
+	// Label names of the series in order, state labels included
+	LabelNames []string
+
+	// Register the family is first seen with
+	register structures.DataUnit
+	// Label names of the registers, i.e. of their read errors
+	registerLabels map[string]bool
+}
+
+// FamilyError is a register which cannot be exported as its metric along with
+// the other registers of the workload
+type FamilyError struct {
+	Device   structures.Device
+	Register structures.DataUnit
+	Err      error
+}
+
+// familyDesc is the descriptor of the metric family, built once per collector
+type familyDesc struct {
+	desc *prometheus.Desc
+	// Label names in order of the descriptor
+	labelNames []string
+	valueType  prometheus.ValueType
+}
+
+// Functions declaration section -----------------------------------------------
+
+// Error implements error
+func (familyError FamilyError) Error() string {
+	return fmt.Sprintf("register '%s': %s", registerName(familyError.Register), familyError.Err.Error())
+}
+
+// WorkloadFamilies returns metric families of the workload, in order of their
+// first register (devices in order of modbus id), and every register which
+// cannot be exported along with the others, as Prometheus rejects the whole
+// scrape otherwise: register setting state labels of its own, register exported
+// as a metric of the exporter itself (e.g. 'modbus_up'), register of the
+// metric with other label names, help or type than the first register of the
+// metric, or register exporting the same series as another one.
+func WorkloadFamilies(workload map[structures.Device]structures.Registers) ([]*Family, []FamilyError) {
+
+	var (
+		families []*Family
+		problems []FamilyError
+	)
+
+	devices := make([]structures.Device, 0, len(workload))
+	for device := range workload {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ModbusID < devices[j].ModbusID })
+
+	byName := make(map[string]*Family)
+	// Register of every series exported
+	series := make(map[string]structures.DataUnit)
+
+	for _, device := range devices {
+		for _, register := range workload[device] {
+
+			if register.Internal {
+				continue
+			}
+
+			problem := func(error error) {
+				problems = append(problems, FamilyError{Device: device, Register: register, Err: error})
+			}
+
+			// State labels are set by the state series themselves
+			reserved := false
+			for _, label := range StateLabels(register.Type) {
+				if _, ok := register.Labels[label]; ok {
+					problem(fmt.Errorf("label '%s' is reserved for series of '%s' register", label, register.Type))
+					reserved = true
+				}
+			}
+			if reserved {
+				continue
+			}
+
+			name := metricName(register)
+			if reservedNames[name] {
+				problem(fmt.Errorf("metric '%s' is reserved for the exporter", name))
+				continue
+			}
+			labelNames := seriesLabels(register)
+
+			metricFamily, ok := byName[name]
+			if !ok {
+				metricFamily = &Family{
+					Name:           name,
+					Help:           register.Help,
+					MetricType:     register.MetricType,
+					LabelNames:     labelNames,
+					register:       register,
+					registerLabels: make(map[string]bool),
+				}
+				byName[name] = metricFamily
+				families = append(families, metricFamily)
+			}
+
+			first, labels := strings.Join(metricFamily.LabelNames, ","), strings.Join(labelNames, ",")
+
+			switch {
+			case first != labels:
+				problem(fmt.Errorf("metric '%s' has labels [%s] but labels of register '%s' are [%s]", name, labels, registerName(metricFamily.register), first))
+				continue
+			case metricFamily.Help != register.Help:
+				problem(fmt.Errorf("metric '%s' has help '%s' but help of register '%s' is '%s'", name, register.Help, registerName(metricFamily.register), metricFamily.Help))
+				continue
+			case metricFamily.MetricType != register.MetricType:
+				problem(fmt.Errorf("metric '%s' has type '%s' but type of register '%s' is '%s'", name, register.MetricType, registerName(metricFamily.register), metricFamily.MetricType))
+				continue
+			}
+
+			identity := seriesIdentity(name, register.Labels)
+			if previous, ok := series[identity]; ok {
+				problem(fmt.Errorf("duplicate series %s of register '%s'", identity, registerName(previous)))
+				continue
+			}
+			series[identity] = register
+
+			for label := range register.Labels {
+				metricFamily.registerLabels[label] = true
+			}
+		}
+	}
+
+	return families, problems
+}
+
+// CheckWorkload returns the first register of the workload which cannot be
+// exported along with the others, see WorkloadFamilies
+func CheckWorkload(workload map[structures.Device]structures.Registers) error {
+
+	if _, problems := WorkloadFamilies(workload); len(problems) > 0 {
+		return problems[0]
+	}
+
+	return nil
+}
+
+// CheckTargetLabels returns the first of the target labels colliding with
+// labels of the target series: 'target' and 'config' labels, labels set by the
+// exporter (e.g. 'unit_id') or labels of the workload registers. Series with
+// such labels are dropped by Prometheus, as the target label would overwrite
+// the label of the series.
+func CheckTargetLabels(workload map[structures.Device]structures.Registers, labels map[string]string) error {
+
+	families, _ := WorkloadFamilies(workload)
+
+	names := make(map[string]bool, len(labels))
+	for name := range labels {
+		names[name] = true
+	}
+
+	for _, name := range sortedLabels(names) {
+
+		if name == TargetLabel || name == ConfigLabel {
+			return fmt.Errorf("label '%s' is reserved for the target", name)
+		}
+		if reservedLabels[name] {
+			return fmt.Errorf("label '%s' is reserved for the exporter", name)
+		}
+
+		for _, metricFamily := range families {
+			for _, label := range metricFamily.LabelNames {
+				if label == name {
+					return fmt.Errorf("label '%s' is set by register '%s'", name, registerName(metricFamily.register))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// registerName returns name of the register as given in config
+func registerName(register structures.DataUnit) string {
+
+	names := make([]string, 0, len(register.Address))
+	for name := range register.Address {
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+// seriesLabels returns label names of the register series in order, state
+// labels of bitfield, enum and string registers included
+func seriesLabels(register structures.DataUnit) []string {
+
+	names := make([]string, 0, len(register.Labels)+2)
+	for name := range register.Labels {
+		names = append(names, name)
+	}
+	names = append(names, StateLabels(register.Type)...)
+	sort.Strings(names)
+
+	return names
+}
+
+// seriesIdentity returns name and labels of the series, e.g.
+// 'modbus_voltage{register_name="U_A",unit_id="1"}'
+func seriesIdentity(name string, labels map[string]string) string {
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// newFamilyDescs returns descriptor of every metric family of the workload and
+// of the register read errors, label names of which are the union of label
+// names of all registers (read errors add exception code and failure reason).
+// Registers which are not exported along with the others have no descriptor.
+func newFamilyDescs(workload map[structures.Device]structures.Registers) (map[string]*familyDesc, *familyDesc) {
+
+	families, _ := WorkloadFamilies(workload)
+
+	descs := make(map[string]*familyDesc, len(families))
+	errorLabels := make(map[string]bool)
+
+	for _, metricFamily := range families {
+
+		help := metricFamily.Help
+		if help == "" {
+			help = defaultHelp
+		}
+
+		descs[metricFamily.Name] = &familyDesc{
+			desc:       prometheus.NewDesc(metricFamily.Name, help, metricFamily.LabelNames, nil),
+			labelNames: metricFamily.LabelNames,
+			valueType:  valueType(metricFamily.MetricType),
+		}
+
+		for label := range metricFamily.registerLabels {
+			if label != "exception_code" && label != "reason" {
+				errorLabels[label] = true
+			}
+		}
+	}
+
+	labelNames := sortedLabels(errorLabels)
+	readErrors := &familyDesc{
+		desc:       prometheus.NewDesc(readErrorsName, "Registers which cannot be read in the scrape.", append(append([]string{}, labelNames...), "exception_code", "reason"), nil),
+		labelNames: labelNames,
+		valueType:  prometheus.GaugeValue,
+	}
+
+	return descs, readErrors
+}
+
+// labelValues returns values of the family labels in order of the descriptor,
+// labels the given set lacks are empty
+func (metricFamily *familyDesc) labelValues(labels map[string]string, extra ...string) []string {
+
+	values := make([]string, 0, len(metricFamily.labelNames)+len(extra))
+	for _, name := range metricFamily.labelNames {
+		values = append(values, labels[name])
+	}
+
+	return append(values, extra...)
+}
+
+// sortedLabels returns names of the label set in order
+func sortedLabels(labels map[string]bool) []string {
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
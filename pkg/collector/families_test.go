@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+	"github.com/NobleD5/modbus_exporter/pkg/workload"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tbrandon/mbserver"
+)
+
+// voltageParams returns config of two registers exported as the same metric,
+// labels of the second register are given
+func voltageParams(labels map[string]string) *structures.Params {
+
+	return &structures.Params{
+		DeviceModbusID: 1,
+		DeviceTimeout:  "1000ms",
+		DeviceRegisters: []structures.Register{
+			*structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#300", "FC3", map[string]string{"phase": "A"}),
+			*structures.NewRegister("U_AB", "voltage", "uint16", "", "", "dec#301", "FC3", labels),
+		},
+	}
+}
+
+func TestCheckWorkload(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1909"); err != nil {
+		t.Fatalf("CheckWorkload() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[300] = 230
+	serv.HoldingRegisters[301] = 400
+
+	// ---------------------------------------------------------------------------
+	//  CASE: registers of the same metric with different label names, unchecked
+	//  collector gathers them fine, yet the workload is rejected on purpose:
+	//  the exporter describes a metric family by a single descriptor, so all its
+	//  series must share label names (stricter than Prometheus itself)
+	// ---------------------------------------------------------------------------
+	units, err := workload.PrepareConfig(voltageParams(map[string]string{"line": "AB"}), logger)
+	if err != nil {
+		t.Fatalf("PrepareConfig() : Test 1 FAILED, %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&Collector{Target: "localhost:1909", Workload: units, Logger: logger})
+	_, gatherErr := registry.Gather()
+
+	awaiting := "register 'U_AB': metric 'modbus_voltage' has labels [line,register_name,unit_id] but labels of register 'U_A' are [phase,register_name,unit_id]"
+	err = CheckWorkload(units)
+	if gatherErr == nil && err != nil && err.Error() == awaiting {
+		t.Log("CheckWorkload() : Test 1 PASSED.")
+	} else {
+		t.Errorf("CheckWorkload() : Test 1 FAILED, \nawaiting: \"%s\", \ngot: \"%v\", gather error: %v", awaiting, err, gatherErr)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: registers exporting the same series fail the whole gather
+	// ---------------------------------------------------------------------------
+	units, err = workload.PrepareConfig(voltageParams(map[string]string{"phase": "A", "register_name": "U_A"}), logger)
+	if err != nil {
+		t.Fatalf("PrepareConfig() : Test 2 FAILED, %s", err)
+	}
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(&Collector{Target: "localhost:1909", Workload: units, Logger: logger})
+	_, gatherErr = registry.Gather()
+
+	awaiting = "register 'U_AB': duplicate series modbus_voltage{phase=\"A\",register_name=\"U_A\",unit_id=\"1\"} of register 'U_A'"
+	err = CheckWorkload(units)
+	if gatherErr != nil && strings.Contains(gatherErr.Error(), "was collected before with the same name and label values") &&
+		err != nil && err.Error() == awaiting {
+		t.Logf("CheckWorkload() : Test 2 PASSED, gather fails: %s", gatherErr)
+	} else {
+		t.Errorf("CheckWorkload() : Test 2 FAILED, \nawaiting: \"%s\", \ngot: \"%v\", gather error: %v", awaiting, err, gatherErr)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: series of the same metric told by label values are consistent
+	// ---------------------------------------------------------------------------
+	units, err = workload.PrepareConfig(voltageParams(map[string]string{"phase": "B"}), logger)
+	if err != nil {
+		t.Fatalf("PrepareConfig() : Test 3 FAILED, %s", err)
+	}
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(NewModbusCollector("localhost:1909", units, logger))
+	_, gatherErr = registry.Gather()
+
+	if err = CheckWorkload(units); err == nil && gatherErr == nil {
+		t.Log("CheckWorkload() : Test 3 PASSED.")
+	} else {
+		t.Errorf("CheckWorkload() : Test 3 FAILED, error: %v, gather error: %v", err, gatherErr)
+	}
+
+}
+
+func TestReservedNames(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1915"); err != nil {
+		t.Fatalf("CheckWorkload() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	testCases := []struct {
+		siName string
+		// Metric of the exporter is collected along with the register
+		collected bool
+	}{
+		{"up", true},
+		{"scrape_success", true},
+		{"device_info", false},
+		{"register_read_errors", false},
+		{"poll_stale", false},
+	}
+
+	for each, testCase := range testCases {
+
+		siName := testCase.siName
+
+		params := &structures.Params{
+			DeviceRegisters: []structures.Register{
+				*structures.NewRegister("R", siName, "uint16", "", "", "dec#300", "FC3", nil),
+			},
+		}
+		units, err := workload.PrepareConfig(params, logger)
+		if err != nil {
+			t.Fatalf("PrepareConfig() : Test %d FAILED, %s", each+1, err)
+		}
+
+		// ---------------------------------------------------------------------------
+		//  CASE: register exported as a metric of the exporter fails the whole
+		//        gather (once the metric is collected), it is rejected when
+		//        workload is prepared instead
+		// ---------------------------------------------------------------------------
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(NewModbusCollector("localhost:1915", units, logger))
+		_, gatherErr := registry.Gather()
+
+		awaiting := "register 'R': metric 'modbus_" + siName + "' is reserved for the exporter"
+		err = CheckWorkload(units)
+		if (gatherErr != nil || !testCase.collected) && err != nil && err.Error() == awaiting {
+			t.Logf("CheckWorkload() : Reserved Test %d PASSED, gather fails: %s", each+1, gatherErr)
+		} else {
+			t.Errorf("CheckWorkload() : Reserved Test %d FAILED, \nawaiting: \"%s\", \ngot: \"%v\", gather error: %v", each+1, awaiting, err, gatherErr)
+		}
+	}
+
+}
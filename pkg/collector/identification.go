@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/master"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// identificationKey identifies device (unit) of the target and level of its
+// identification
+type identificationKey struct {
+	address, level string
+	modbusID       byte
+}
+
+// identification is device identification read at the given time, no objects
+// mean the device does not support it
+type identification struct {
+	objects map[byte]string
+	time    time.Time
+}
+
+// IdentificationCache keeps device identifications read, so they are not read
+// on every scrape of the target
+type IdentificationCache struct {
+	// Identifications are read again once TTL is passed
+	TTL time.Duration
+	// Oldest identifications are dropped to keep at most MaxEntries, no limit
+	// if not set
+	MaxEntries int
+
+	mu              sync.Mutex
+	identifications map[identificationKey]identification
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Identification is assumed not to change while the device is running
+	defaultIdentificationTTL = time.Hour
+	// Devices (units) identified at once, targets are given by requests
+	defaultIdentificationEntries = 1024
+
+	// Objects of extended identification below are reserved by MODBUS
+	firstPrivateObject = 0x80
+)
+
+// Variables declaration section -----------------------------------------------
+var (
+	// DefaultIdentificationCache is the cache of device identifications
+	// shared by scrapes and polls
+	DefaultIdentificationCache = &IdentificationCache{TTL: defaultIdentificationTTL, MaxEntries: defaultIdentificationEntries}
+
+	// Label names of the standard identification objects, by object id
+	identificationLabels = []string{
+		"vendor",
+		"product_code",
+		"revision",
+		"vendor_url",
+		"product_name",
+		"model_name",
+		"user_application_name",
+	}
+
+	deviceInfoDesc       = newTargetDesc("modbus_device_info", "Identification of the MODBUS device.", append([]string{"unit_id"}, identificationLabels...))
+	deviceObjectInfoDesc = newTargetDesc("modbus_device_object_info", "Private (extended) identification objects of the MODBUS device.", []string{"unit_id", "object", "value"})
+)
+
+// Functions declaration section -----------------------------------------------
+
+// Identification returns identification of the device (unit) of the target,
+// read over the connection unless it is in the cache. Devices replying with
+// MODBUS exception do not support identification, which is cached as well,
+// other errors are returned so that identification is read on the next scrape.
+func (cache *IdentificationCache) Identification(ctx context.Context, connection *master.Connection, address string, device structures.Device, logger log.Logger) (map[byte]string, error) {
+
+	key := identificationKey{address: address, level: device.ReadIdentification, modbusID: device.ModbusID}
+
+	cache.mu.Lock()
+	cached, ok := cache.identifications[key]
+	cache.mu.Unlock()
+
+	if ok && time.Since(cached.time) < cache.TTL {
+		return cached.objects, nil
+	}
+
+	objects, error := connection.ReadIdentification(ctx, device, logger)
+	if error != nil {
+		if _, exception := master.ExceptionCode(error); !exception {
+			return nil, error
+		}
+		level.Warn(logger).Log("msg", "Device does not support identification", "address", address, "modbus_id", device.ModbusID, "err", error)
+		objects = nil
+	}
+
+	cache.mu.Lock()
+	if cache.identifications == nil {
+		cache.identifications = make(map[identificationKey]identification)
+	}
+	cache.identifications[key] = identification{objects: objects, time: time.Now()}
+	cache.evict()
+	cache.mu.Unlock()
+
+	return objects, nil
+}
+
+// evict drops expired identifications, then the oldest ones beyond
+// MaxEntries, caller must hold the mutex
+func (cache *IdentificationCache) evict() {
+
+	for key, cached := range cache.identifications {
+		if time.Since(cached.time) >= cache.TTL {
+			delete(cache.identifications, key)
+		}
+	}
+
+	if cache.MaxEntries <= 0 || len(cache.identifications) <= cache.MaxEntries {
+		return
+	}
+
+	keys := make([]identificationKey, 0, len(cache.identifications))
+	for key := range cache.identifications {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return cache.identifications[keys[i]].time.Before(cache.identifications[keys[j]].time)
+	})
+
+	for _, key := range keys[:len(keys)-cache.MaxEntries] {
+		delete(cache.identifications, key)
+	}
+}
+
+// identificationSamples returns info samples of the device identification:
+// standard objects are labels of the device info, private objects are info
+// of their own
+func identificationSamples(unitID string, objects map[byte]string) []prometheus.Metric {
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	samples := make([]prometheus.Metric, 0, len(objects))
+
+	labelValues := make([]string, 0, len(identificationLabels)+1)
+	labelValues = append(labelValues, unitID)
+	for id := range identificationLabels {
+		labelValues = append(labelValues, objects[byte(id)])
+	}
+	samples = append(samples, prometheus.MustNewConstMetric(deviceInfoDesc, prometheus.GaugeValue, 1, labelValues...))
+
+	ids := make([]int, 0, len(objects))
+	for id := range objects {
+		if id >= firstPrivateObject {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		samples = append(samples, prometheus.MustNewConstMetric(deviceObjectInfoDesc, prometheus.GaugeValue, 1, unitID, fmt.Sprintf("0x%02X", id), objects[byte(id)]))
+	}
+
+	return samples
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tbrandon/mbserver"
+)
+
+func TestCollectorIdentification(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	var identified, refused int32
+
+	serv := mbserver.NewServer()
+	serv.RegisterFunctionHandler(0x2B, func(s *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		atomic.AddInt32(&identified, 1)
+		// Basic objects, then a private one of extended identification
+		data := []byte{0x0E, frame.GetData()[1], 0x83, 0x00, 0x00, 0x00}
+		objects := [][]byte{{0x00, 4, 'A', 'C', 'M', 'E'}, {0x01, 3, 'P', '-', '1'}, {0x02, 4, 'V', '2', '.', '0'}, {0x80, 2, 'X', '1'}}
+		for _, object := range objects {
+			data = append(data, object...)
+			data[5]++
+		}
+		return data, &mbserver.Success
+	})
+	if err := serv.ListenTCP("localhost:1913"); err != nil {
+		t.Fatalf("Collector() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	plain := mbserver.NewServer()
+	plain.RegisterFunctionHandler(0x2B, func(s *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+		atomic.AddInt32(&refused, 1)
+		return []byte{}, &mbserver.IllegalFunction
+	})
+	if err := plain.ListenTCP("localhost:1914"); err != nil {
+		t.Fatalf("Collector() : cannot listen, %s", err)
+	}
+	defer plain.Close()
+
+	register := structures.NewDataUnit(map[string]uint16{"U_A": 10}, 0, "voltage", "word", "", "", "FC3", map[string]string{"register_name": "U_A"})
+	register.MetricName = "modbus_voltage"
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+	device.ReadIdentification = "extended"
+	workload := map[structures.Device]structures.Registers{*device: {*register}}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: standard objects are labels of device info, private ones are info
+	//        of their own, identification is read once
+	// ---------------------------------------------------------------------------
+	expected := `# HELP modbus_device_info Identification of the MODBUS device.
+# TYPE modbus_device_info gauge
+modbus_device_info{model_name="",product_code="P-1",product_name="",revision="V2.0",unit_id="1",user_application_name="",vendor="ACME",vendor_url=""} 1
+# HELP modbus_device_object_info Private (extended) identification objects of the MODBUS device.
+# TYPE modbus_device_object_info gauge
+modbus_device_object_info{object="0x80",unit_id="1",value="X1"} 1
+`
+	for each := 1; each <= 2; each++ {
+		err := testutil.CollectAndCompare(NewModbusCollector("localhost:1913", workload, logger), strings.NewReader(expected), "modbus_device_info", "modbus_device_object_info")
+		if err == nil && atomic.LoadInt32(&identified) == 1 {
+			t.Logf("Collector() : Identification Test %d PASSED.", each)
+		} else {
+			t.Errorf("Collector() : Identification Test %d FAILED, requests: %d, %v", each, atomic.LoadInt32(&identified), err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device replying with exception has no identification, which is
+	//        not read again either
+	// ---------------------------------------------------------------------------
+	for each := 3; each <= 4; each++ {
+		count := testutil.CollectAndCount(NewModbusCollector("localhost:1914", workload, logger), "modbus_device_info", "modbus_voltage")
+		if count == 1 && atomic.LoadInt32(&refused) == 1 {
+			t.Logf("Collector() : Identification Test %d PASSED.", each)
+		} else {
+			t.Errorf("Collector() : Identification Test %d FAILED, series: %d, requests: %d", each, count, atomic.LoadInt32(&refused))
+		}
+	}
+
+}
+
+func TestIdentificationCacheEvict(t *testing.T) {
+
+	now := time.Now()
+
+	cache := &IdentificationCache{TTL: time.Hour, MaxEntries: 2}
+	cache.identifications = map[identificationKey]identification{
+		{address: "10.0.0.1:502", level: "basic", modbusID: 1}: {time: now.Add(-2 * time.Hour)},
+		{address: "10.0.0.2:502", level: "basic", modbusID: 1}: {time: now.Add(-30 * time.Minute)},
+		{address: "10.0.0.3:502", level: "basic", modbusID: 1}: {time: now.Add(-20 * time.Minute)},
+		{address: "10.0.0.4:502", level: "basic", modbusID: 1}: {time: now},
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: expired identifications are dropped, then the oldest ones beyond
+	//        the limit
+	// ---------------------------------------------------------------------------
+	cache.evict()
+
+	_, newer := cache.identifications[identificationKey{address: "10.0.0.3:502", level: "basic", modbusID: 1}]
+	_, newest := cache.identifications[identificationKey{address: "10.0.0.4:502", level: "basic", modbusID: 1}]
+	if len(cache.identifications) == 2 && newer && newest {
+		t.Log("IdentificationCache.evict() : Test 1 PASSED.")
+	} else {
+		t.Errorf("IdentificationCache.evict() : Test 1 FAILED, identifications: %v", cache.identifications)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: no limit but TTL if MaxEntries is not set
+	// ---------------------------------------------------------------------------
+	cache.MaxEntries = 0
+	cache.identifications[identificationKey{address: "10.0.0.5:502", level: "basic", modbusID: 1}] = identification{time: now}
+	cache.evict()
+
+	if len(cache.identifications) == 3 {
+		t.Log("IdentificationCache.evict() : Test 2 PASSED.")
+	} else {
+		t.Errorf("IdentificationCache.evict() : Test 2 FAILED, identifications: %v", cache.identifications)
+	}
+
+}
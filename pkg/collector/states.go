@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NobleD5/modbus_exporter/pkg/master"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Labels of the state series
+	bitLabel   = "bit"
+	flagLabel  = "flag"
+	stateLabel = "state"
+	valueLabel = "value"
+)
+
+// Functions declaration section -----------------------------------------------
+
+// StateLabels returns names of the labels set by series of the register type:
+// 'bit' and 'flag' of bitfield registers, 'state' of enum registers, 'value' of
+// string registers, none of the others
+func StateLabels(regType string) []string {
+
+	switch strings.ToLower(regType) {
+	case master.TypeBitfield:
+		return []string{bitLabel, flagLabel}
+	case master.TypeEnum:
+		return []string{stateLabel}
+	case master.TypeString:
+		return []string{valueLabel}
+	default:
+		return nil
+	}
+}
+
+// expandStates returns data units of every series of the data unit: every
+// named bit of bitfield register is a series of the bit state (0 or 1), every
+// named value of enum register is a series which is 1 for the current value
+// and 0 for the others (i.e. a state set). String register is a series of
+// value 1 with the text as 'value' label (i.e. an info metric). Other data units
+// are returned as they are.
+func expandStates(dataUnit structures.DataUnit) []structures.DataUnit {
+
+	regType := strings.ToLower(dataUnit.Type)
+
+	switch regType {
+	case master.TypeBitfield, master.TypeEnum:
+	case master.TypeString:
+		info := dataUnit
+		info.Labels = make(map[string]string, len(dataUnit.Labels)+1)
+		for name, value := range dataUnit.Labels {
+			info.Labels[name] = value
+		}
+		info.Labels[valueLabel] = dataUnit.Text
+		info.Value = 1
+		return []structures.DataUnit{info}
+	default:
+		return []structures.DataUnit{dataUnit}
+	}
+
+	keys := make([]int, 0, len(dataUnit.States))
+	for k := range dataUnit.States {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	raw := uint64(dataUnit.Value)
+	series := make([]structures.DataUnit, 0, len(keys))
+
+	for _, k := range keys {
+
+		state := dataUnit
+		state.Labels = make(map[string]string, len(dataUnit.Labels)+2)
+		for name, value := range dataUnit.Labels {
+			state.Labels[name] = value
+		}
+
+		if regType == master.TypeBitfield {
+			state.Labels[bitLabel] = strconv.Itoa(k)
+			state.Labels[flagLabel] = dataUnit.States[k]
+			state.Value = float64((raw >> uint(k)) & 1)
+		} else {
+			state.Labels[stateLabel] = dataUnit.States[k]
+			state.Value = 0
+			if raw == uint64(k) {
+				state.Value = 1
+			}
+		}
+
+		series = append(series, state)
+	}
+
+	return series
+}
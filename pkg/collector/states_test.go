@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tbrandon/mbserver"
+)
+
+// statesWorkload returns workload of bitfield and enum registers
+func statesWorkload() map[structures.Device]structures.Registers {
+
+	status := structures.NewDataUnit(map[string]uint16{"UPS_STATUS": 300}, 0, "ups_status", "bitfield", "", "", "FC3", map[string]string{"register_name": "UPS_STATUS"})
+	status.States = map[int]string{0: "on_battery", 3: "overload", 15: "fault"}
+
+	mode := structures.NewDataUnit(map[string]uint16{"UPS_MODE": 301}, 0, "ups_mode", "enum", "", "", "FC3", map[string]string{"register_name": "UPS_MODE"})
+	mode.States = map[int]string{0: "off", 1: "standby", 2: "run"}
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+
+	return map[structures.Device]structures.Registers{*device: {*status, *mode}}
+}
+
+func TestRegisterToSamplesStates(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	var registers structures.Registers
+	for _, units := range statesWorkload() {
+		registers = units
+	}
+	registers[0].Value = 0x0009
+	registers[1].Value = 2
+
+	testCases := []struct {
+		dataUnit structures.DataUnit
+		awaiting string
+	}{
+		{
+			registers[0],
+			"# HELP modbus_ups_status Value of the MODBUS register.\n# TYPE modbus_ups_status gauge\n" +
+				"modbus_ups_status{bit=\"0\",flag=\"on_battery\",register_name=\"UPS_STATUS\"} 1\n" +
+				"modbus_ups_status{bit=\"15\",flag=\"fault\",register_name=\"UPS_STATUS\"} 0\n" +
+				"modbus_ups_status{bit=\"3\",flag=\"overload\",register_name=\"UPS_STATUS\"} 1\n",
+		},
+		{
+			registers[1],
+			"# HELP modbus_ups_mode Value of the MODBUS register.\n# TYPE modbus_ups_mode gauge\n" +
+				"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"off\"} 0\n" +
+				"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"run\"} 1\n" +
+				"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"standby\"} 0\n",
+		},
+	}
+
+	for each, testCase := range testCases {
+
+		samples, err := RegisterToSamples(testCase.dataUnit, logger)
+		if err != nil {
+			t.Fatalf("RegisterToSamples() : States Test %d FAILED, %s", each+1, err)
+		}
+
+		if err := testutil.CollectAndCompare(samplesCollector(samples), strings.NewReader(testCase.awaiting)); err == nil {
+			t.Logf("RegisterToSamples() : States Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("RegisterToSamples() : States Test %d FAILED, %s", each+1, err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: value which is not a named state, every state series is 0
+	// ---------------------------------------------------------------------------
+	registers[1].Value = 7
+
+	samples, _ := RegisterToSamples(registers[1], logger)
+	awaiting := "# HELP modbus_ups_mode Value of the MODBUS register.\n# TYPE modbus_ups_mode gauge\n" +
+		"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"off\"} 0\n" +
+		"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"run\"} 0\n" +
+		"modbus_ups_mode{register_name=\"UPS_MODE\",state=\"standby\"} 0\n"
+
+	if err := testutil.CollectAndCompare(samplesCollector(samples), strings.NewReader(awaiting)); err == nil {
+		t.Log("RegisterToSamples() : States Test 3 PASSED.")
+	} else {
+		t.Errorf("RegisterToSamples() : States Test 3 FAILED, %s", err)
+	}
+
+}
+
+func TestCollectorStates(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1911"); err != nil {
+		t.Fatalf("Collector() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[300] = 0x8001
+	serv.HoldingRegisters[301] = 1
+
+	// ---------------------------------------------------------------------------
+	//  CASE: states are read and collected by checked collector
+	// ---------------------------------------------------------------------------
+	expected := `# HELP modbus_ups_mode Value of the MODBUS register.
+# TYPE modbus_ups_mode gauge
+modbus_ups_mode{register_name="UPS_MODE",state="off"} 0
+modbus_ups_mode{register_name="UPS_MODE",state="run"} 0
+modbus_ups_mode{register_name="UPS_MODE",state="standby"} 1
+# HELP modbus_ups_status Value of the MODBUS register.
+# TYPE modbus_ups_status gauge
+modbus_ups_status{bit="0",flag="on_battery",register_name="UPS_STATUS"} 1
+modbus_ups_status{bit="15",flag="fault",register_name="UPS_STATUS"} 1
+modbus_ups_status{bit="3",flag="overload",register_name="UPS_STATUS"} 0
+`
+	err := testutil.CollectAndCompare(NewModbusCollector("localhost:1911", statesWorkload(), logger), strings.NewReader(expected), "modbus_ups_mode", "modbus_ups_status")
+	if err == nil {
+		t.Log("Collector() : States Test 1 PASSED.")
+	} else {
+		t.Errorf("Collector() : States Test 1 FAILED, %s", err)
+	}
+
+}
+
+func TestCollectorInfo(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1912"); err != nil {
+		t.Fatalf("Collector() : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	// "SN-1234" padded with NUL, BCD 20231125
+	copy(serv.HoldingRegisters[130:], []uint16{0x534E, 0x2D31, 0x3233, 0x3400})
+	copy(serv.HoldingRegisters[200:], []uint16{0x2023, 0x1125})
+
+	serial := structures.NewDataUnit(map[string]uint16{"SERIAL": 130}, 0, "serial_number", "string", "", "", "FC3", map[string]string{"register_name": "SERIAL"})
+	serial.MetricName = "modbus_serial_number_info"
+	serial.Length = 4
+
+	date := structures.NewDataUnit(map[string]uint16{"DATE": 200}, 0, "manufacturing_date", "bcd32", "", "", "FC3", map[string]string{"register_name": "DATE"})
+	date.MetricName = "modbus_manufacturing_date"
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+	workload := map[structures.Device]structures.Registers{*device: {*serial, *date}}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: string is the value label of info metric, BCD is a gauge
+	// ---------------------------------------------------------------------------
+	expected := `# HELP modbus_manufacturing_date Value of the MODBUS register.
+# TYPE modbus_manufacturing_date gauge
+modbus_manufacturing_date{register_name="DATE"} 2.0231125e+07
+# HELP modbus_serial_number_info Value of the MODBUS register.
+# TYPE modbus_serial_number_info gauge
+modbus_serial_number_info{register_name="SERIAL",value="SN-1234"} 1
+`
+	err := testutil.CollectAndCompare(NewModbusCollector("localhost:1912", workload, logger), strings.NewReader(expected), "modbus_serial_number_info", "modbus_manufacturing_date")
+	if err == nil {
+		t.Log("Collector() : Info Test 1 PASSED.")
+	} else {
+		t.Errorf("Collector() : Info Test 1 FAILED, %s", err)
+	}
+
+}
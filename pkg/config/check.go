@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NobleD5/modbus_exporter/pkg/master"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+	"github.com/NobleD5/modbus_exporter/pkg/workload"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// registerRange is the range of addresses read for the register
+type registerRange struct {
+	name, funcCode string
+	first, last    int
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Last address of MODBUS data model
+	maxAddress = 65535
+)
+
+// Functions declaration section -----------------------------------------------
+
+// CheckConf checks workload of every device in the given (validated) Config,
+// i.e. what is read rather than settings themselves (series colliding in
+// Prometheus are rejected by validation). Registers beyond address space are
+// problems. Overlapping register ranges are warnings as the same registers may
+// be read as different types on purpose, so is block length beyond the PDU
+// limits, as requests are limited to them anyway.
+func CheckConf(config *structures.Config, logger log.Logger) (problems ValidationErrors, warnings ValidationErrors) {
+
+	names := make([]string, 0, len(config.Devices))
+	for name, params := range config.Devices {
+		if params != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		params := config.Devices[name]
+
+		problem := func(register string, error error) {
+			problems = append(problems, ValidationError{File: params.File, Device: name, Register: register, Err: error})
+		}
+		warning := func(register string, error error) {
+			warnings = append(warnings, ValidationError{File: params.File, Device: name, Register: register, Err: error})
+		}
+
+		units, error := workload.PrepareConfig(params, logger)
+		if error != nil {
+			problem("", error)
+			continue
+		}
+
+		devices := make([]structures.Device, 0, len(units))
+		for device := range units {
+			devices = append(devices, device)
+		}
+		sort.Slice(devices, func(i, j int) bool { return devices[i].ModbusID < devices[j].ModbusID })
+
+		// Function codes read, i.e. PDU limits the block length is clamped to
+		var readsRegisters, readsBits bool
+
+		for _, device := range devices {
+
+			unit := ""
+			if len(params.DeviceUnits) > 0 {
+				unit = fmt.Sprintf("unit %d: ", device.ModbusID)
+			}
+
+			var ranges []registerRange
+
+			for _, register := range units[device] {
+
+				regName := registerName(register)
+
+				funcCode, first, last, error := master.RegisterRange(register, device.ZeroBased)
+				if error != nil {
+					problem(regName, fmt.Errorf("%s%s", unit, error.Error()))
+					continue
+				}
+				if master.IsBitAccess(funcCode) {
+					readsBits = true
+				} else {
+					readsRegisters = true
+				}
+				if first < 0 || last > maxAddress {
+					problem(regName, fmt.Errorf("%s%s address %d (%d registers) is beyond address space", unit, funcCode, first, last-first+1))
+					continue
+				}
+
+				// Scale factors are read along, they are not exported
+				if register.Internal {
+					continue
+				}
+
+				for _, other := range ranges {
+					if other.funcCode == funcCode && other.first <= last && first <= other.last {
+						warning(regName, fmt.Errorf("%s%s address range %d-%d overlaps register '%s' (%d-%d)", unit, funcCode, first, last, other.name, other.first, other.last))
+					}
+				}
+				ranges = append(ranges, registerRange{name: regName, funcCode: funcCode, first: first, last: last})
+			}
+		}
+
+		// Requests are never longer than the PDU limits, whatever the setting is
+		maxLength := int(params.DeviceMaxBlockLength)
+		if readsRegisters && maxLength > master.MaxRegistersPerRequest {
+			warning("", fmt.Errorf("device_max_block_length %d exceeds PDU limit, register reads are limited to %d registers", maxLength, master.MaxRegistersPerRequest))
+		}
+		if readsBits && maxLength > master.MaxBitsPerRequest {
+			warning("", fmt.Errorf("device_max_block_length %d exceeds PDU limit, coil and discrete input reads are limited to %d bits", maxLength, master.MaxBitsPerRequest))
+		}
+	}
+
+	return problems, warnings
+}
+
+// registerName returns name of the register given in config
+func registerName(register structures.DataUnit) string {
+
+	for name := range register.Address {
+		return name
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestCheckConf(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	testCases := []struct {
+		input    string
+		problems string
+		warnings string
+	}{
+		// CASE: registers read once, series of units told by 'unit_id'
+		{"PLC:\n  device_units:\n    - unit_modbus_id: 1\n    - unit_modbus_id: 2\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_type: float32\n      register_address: dec#300\n      register_func_code: FC3\n    - register_name: U_B\n      register_si_name: voltage\n      register_address: dec#302\n      register_func_code: FC3\n    - register_name: Run\n      register_address: dec#300\n      register_func_code: FC1", "", ""},
+		// CASE: overlapping registers are warned
+		{"PLC:\n  device_registers:\n    - register_name: I_A\n      register_type: uint32\n      register_address: dec#300\n      register_func_code: FC3\n    - register_name: I_B\n      register_address: dec#301\n      register_func_code: FC3", "",
+			"device 'PLC': register 'I_B': FC3 address range 301-301 overlaps register 'I_A' (300-301)"},
+		// CASE: requests beyond address space, block length beyond PDU limit of registers
+		{"PLC:\n  device_zero_based_addressing: true\n  device_max_block_length: 200\n  device_registers:\n    - register_name: E\n      register_type: uint64\n      register_address: hex#FFFE",
+			"device 'PLC': register 'E': FC4 address 65533 (4 registers) is beyond address space",
+			"device 'PLC': device_max_block_length 200 exceeds PDU limit, register reads are limited to 125 registers"},
+		// CASE: block length of coils is limited to 2000 bits
+		{"PLC:\n  device_max_block_length: 200\n  device_registers:\n    - register_name: Run\n      register_address: dec#1\n      register_func_code: FC1", "", ""},
+		{"PLC:\n  device_max_block_length: 4000\n  device_registers:\n    - register_name: Run\n      register_address: dec#1\n      register_func_code: FC1", "",
+			"device 'PLC': device_max_block_length 4000 exceeds PDU limit, coil and discrete input reads are limited to 2000 bits"},
+	}
+
+	for each, testCase := range testCases {
+
+		config, err := UnmarshallConf(testCase.input, logger)
+		if err != nil {
+			t.Fatalf("UnmarshallConf() : FAILED, %s", err)
+		}
+		if err = ValidateConf(config, logger); err != nil {
+			t.Fatalf("ValidateConf() : FAILED, %s", err)
+		}
+
+		problems, warnings := CheckConf(config, logger)
+		if problems.Error() == testCase.problems && warnings.Error() == testCase.warnings {
+			t.Logf("CheckConf() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("CheckConf() : Test %d FAILED, \nawaiting problems: \"%s\", warnings: \"%s\", \ngot: \"%s\", \"%s\"",
+				each+1, testCase.problems, testCase.warnings, problems, warnings)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: configs shipped are free of problems
+	// ---------------------------------------------------------------------------
+	for _, file := range []string{"../testdata/valid_modbus_conf.yaml", "../testdata/testdir"} {
+		config, err := Load(file, logger)
+		if err != nil {
+			t.Fatalf("Load() : FAILED, %s", err)
+		}
+		if problems, _ := CheckConf(config, logger); len(problems) == 0 {
+			t.Logf("CheckConf() : Test %s PASSED.", strings.TrimPrefix(file, "../testdata/"))
+		} else {
+			t.Errorf("CheckConf() : Test %s FAILED, got: %s", file, problems)
+		}
+	}
+
+}
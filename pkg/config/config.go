@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
@@ -12,80 +15,249 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// Types declaration section ---------------------------------------------------
+
+// loader parses config files one by one and merges them into the config,
+// every file is loaded once
+type loader struct {
+	config *structures.Config
+	// Files devices (profiles) are loaded from, by their name
+	files        map[string]string
+	profileFiles map[string]string
+	loaded       map[string]bool
+	logger       log.Logger
+}
+
 // Functions declaration section -----------------------------------------------
 
-// Load parses the given YAML file(s) into a Config.
-func Load(dirname string, logger log.Logger) (*structures.Config, error) {
+// Load parses the given YAML file, directory of YAML files or glob pattern
+// (e.g. 'conf.d/*.yaml') into a Config. Files are parsed one by one and merged,
+// files of their 'include' are loaded as well.
+func Load(path string, logger log.Logger) (*structures.Config, error) {
 
-	var contents []byte
+	loader := newLoader(logger)
 
-	fi, error := os.Stat(dirname)
+	error := loader.loadPath(path)
 	if error != nil {
-		return nil, fmt.Errorf("error while os.Stat: %s", error.Error())
+		return nil, error
 	}
+	config := loader.config
 
-	switch mode := fi.Mode(); {
+	ResolveProfiles(config)
 
-	case mode.IsDir():
+	error = ValidateConf(config, logger)
+	if error != nil {
+		return nil, fmt.Errorf("error validating config: %w", error)
+	}
 
-		contents, error = LoadDirectory(dirname, logger)
-		if error != nil {
-			return nil, fmt.Errorf("error while LoadDirectory: %s", error.Error())
-		}
+	level.Debug(logger).Log("config: ", fmt.Sprint(config))
+
+	return config, nil
+}
+
+// LoadDirectory parses the given directory of YAML files (*.yaml, *.yml) into a
+// Config, other files and subdirectories are skipped.
+func LoadDirectory(dirname string, logger log.Logger) (*structures.Config, error) {
+
+	loader := newLoader(logger)
+
+	error := loader.loadDirectory(dirname)
+	if error != nil {
+		return nil, error
+	}
+
+	return loader.config, nil
+}
+
+// newLoader returns a loader of an empty config
+func newLoader(logger log.Logger) *loader {
+	return &loader{
+		config: &structures.Config{
+			Devices:  make(map[string]*structures.Params),
+			Profiles: make(map[string]*structures.Profile),
+		},
+		files:        make(map[string]string),
+		profileFiles: make(map[string]string),
+		loaded:       make(map[string]bool),
+		logger:       logger,
+	}
+}
+
+// loadPath loads the file, directory or files (directories) matching pattern
+func (loader *loader) loadPath(path string) error {
 
-	case mode.IsRegular():
+	if strings.ContainsAny(path, "*?[") {
 
-		contents, error = LoadFile(dirname, logger)
+		matches, error := filepath.Glob(path)
 		if error != nil {
-			return nil, fmt.Errorf("error while LoadFile: %s", error.Error())
+			return fmt.Errorf("error matching pattern '%s': %s", path, error.Error())
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no files match pattern '%s'", path)
 		}
 
-	}
+		level.Debug(loader.logger).Log("pattern", path, "files", fmt.Sprint(matches))
 
-	level.Debug(logger).Log("content", fmt.Sprint(string(contents)))
+		for _, match := range matches {
+			error = loader.loadPath(match)
+			if error != nil {
+				return error
+			}
+		}
+		return nil
+	}
 
-	config, error := UnmarshallConf(string(contents), logger)
+	fi, error := os.Stat(path)
 	if error != nil {
-		return nil, fmt.Errorf("error loading read file (content) into config: %s", error.Error())
+		return fmt.Errorf("error while os.Stat: %s", error.Error())
 	}
 
-	level.Debug(logger).Log("config: ", fmt.Sprint(config))
+	if fi.IsDir() {
+		error = loader.loadDirectory(path)
+		if error != nil {
+			return fmt.Errorf("error while LoadDirectory: %s", error.Error())
+		}
+		return nil
+	}
 
-	return config, nil
+	return loader.loadFile(path)
 }
 
-// LoadDirectory parses the given YAML files into a slice of bytes.
-func LoadDirectory(dirname string, logger log.Logger) ([]byte, error) {
-
-	var contents []byte
+// loadDirectory loads YAML files of the directory, in order of their names
+func (loader *loader) loadDirectory(dirname string) error {
 
 	files, error := ioutil.ReadDir(dirname)
 	if error != nil {
-		return nil, fmt.Errorf("error reading given directory: %s", error.Error())
+		return fmt.Errorf("error reading given directory: %s", error.Error())
 	}
 	if len(files) == 0 {
-		return nil, fmt.Errorf("directory is empty")
+		return fmt.Errorf("directory is empty")
 	}
 
-	level.Debug(logger).Log("files", fmt.Sprint(files))
+	loaded := 0
 
 	for _, file := range files {
 
-		level.Debug(logger).Log("file", fmt.Sprint(file))
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".yaml", ".yml":
+		default:
+			level.Debug(loader.logger).Log("msg", "Skipping file of config directory", "file", file.Name())
+			continue
+		}
+		if file.IsDir() {
+			continue
+		}
+
+		error = loader.loadFile(filepath.Join(dirname, file.Name()))
+		if error != nil {
+			return error
+		}
+		loaded++
+	}
+
+	if loaded == 0 {
+		return fmt.Errorf("directory has no YAML (*.yaml, *.yml) files")
+	}
+
+	return nil
+}
+
+// loadFile parses the file, merges it into the config and loads its includes,
+// relative includes are resolved from directory of the file
+func (loader *loader) loadFile(filename string) error {
+
+	key, error := filepath.Abs(filename)
+	if error != nil {
+		key = filename
+	}
+	if loader.loaded[key] {
+		level.Debug(loader.logger).Log("msg", "File is already loaded", "file", filename)
+		return nil
+	}
+	loader.loaded[key] = true
 
-		path := dirname + "/" + file.Name()
+	content, error := LoadFile(filename, loader.logger)
+	if error != nil {
+		return fmt.Errorf("error while LoadFile: %s", error.Error())
+	}
+
+	config, error := UnmarshallConf(string(content), loader.logger)
+	if error != nil {
+		return fmt.Errorf("error loading read file (%s) into config: %s", filename, error.Error())
+	}
+
+	error = loader.merge(config, filename)
+	if error != nil {
+		return error
+	}
+
+	for _, include := range config.Include {
+
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(filename), include)
+		}
 
-		content, error := LoadFile(path, logger)
+		error = loader.loadPath(include)
 		if error != nil {
-			return nil, fmt.Errorf("error reading given file (%s): %s", file.Name(), error.Error())
+			return fmt.Errorf("error including '%s' from %s: %s", include, filename, error.Error())
 		}
-		contents = append(contents, content...)
+	}
+
+	return nil
+}
+
+// merge adds devices, profiles and targets of the file to the config, every
+// device and profile is defined once, devices have settings
+func (loader *loader) merge(config *structures.Config, filename string) error {
+
+	names := make([]string, 0, len(config.Devices))
+	for name := range config.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
 
+		if file, ok := loader.files[name]; ok {
+			return fmt.Errorf("duplicate device '%s' in %s and %s", name, file, filename)
+		}
+		loader.files[name] = filename
+
+		// Device defined with no settings at all is loaded as nil
+		params := config.Devices[name]
+		if params == nil {
+			return fmt.Errorf("empty device '%s' in %s", name, filename)
+		}
+		params.File = filename
+		loader.config.Devices[name] = params
 	}
 
-	level.Debug(logger).Log("contents: ", fmt.Sprint(contents))
+	names = names[:0]
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		if file, ok := loader.profileFiles[name]; ok {
+			return fmt.Errorf("duplicate profile '%s' in %s and %s", name, file, filename)
+		}
+		loader.profileFiles[name] = filename
+
+		profile := config.Profiles[name]
+		if profile != nil {
+			profile.File = filename
+		}
+		loader.config.Profiles[name] = profile
+	}
+
+	for _, target := range config.Targets {
+		target.File = filename
+		loader.config.Targets = append(loader.config.Targets, target)
+	}
 
-	return contents, nil
+	return nil
 }
 
 // LoadFile parses the given YAML file into a slice of bytes.
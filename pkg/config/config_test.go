@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/kit/log"
@@ -103,7 +104,7 @@ func TestLoad(t *testing.T) {
 		AwaitingNoDir    = errors.New("error while os.Stat: stat ../testdat: no such file or directory")
 		AwaitingEmptyDir = errors.New("error while LoadDirectory: directory is empty")
 		AwaitingWrYAML   = errors.New(
-			"error loading read file (content) into config: error unmarshaling given yaml input: yaml: unmarshal errors:\n" +
+			"error loading read file (../testdata/invalid_modbus_conf.yaml) into config: error unmarshaling given yaml input: yaml: unmarshal errors:\n" +
 				"  line 3: cannot unmarshal !!seq into structures.Params",
 		)
 	)
@@ -175,3 +176,110 @@ func TestLoad(t *testing.T) {
 	// }
 
 }
+
+func TestLoadMerge(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	device := func(name string) string {
+		return name + ":\n  device_registers:\n    - register_name: U_A\n      register_address: dec#300"
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		// No trailing newline
+		"conf.d/a.yaml":    device("PLC1"),
+		"conf.d/b.yml":     device("PLC2") + "\ntargets:\n  - target: 10.0.0.2:502\n    config: PLC2\n",
+		"conf.d/README":    "Devices of the plant",
+		"conf.d/c.yaml~":   device("PLC1"),
+		"conf.d/old.bak":   device("PLC2"),
+		"main.yaml":        "include:\n  - conf.d/*.yaml\n  - extra\n" + device("PLC0"),
+		"extra/d.yaml":     "include: [../main.yaml]\n" + device("PLC3"),
+		"dup/a.yaml":       device("PLC1"),
+		"dup/b.yaml":       device("PLC1"),
+		"missing.yaml":     "include: [nowhere.yaml]\n",
+		"conf.d/sub/e.yml": device("PLC1"),
+		"empty.yaml":       device("PLC1") + "\nPLC2:\n",
+	}
+	for name, content := range files {
+		path := dir + "/" + name
+		if err := os.MkdirAll(path[:strings.LastIndex(path, "/")], 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: files are parsed one by one, only YAML files of directory are read
+	// ---------------------------------------------------------------------------
+	config, err := Load(dir+"/conf.d", logger)
+	if err == nil && len(config.Devices) == 2 &&
+		config.Devices["PLC1"].File == dir+"/conf.d/a.yaml" &&
+		config.Devices["PLC2"].File == dir+"/conf.d/b.yml" &&
+		len(config.Targets) == 1 && config.Targets[0].File == dir+"/conf.d/b.yml" {
+		t.Log("Load() : Merge Test 1 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 1 FAILED, error: %v, config: %+v", err, config)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: duplicate device names both files
+	// ---------------------------------------------------------------------------
+	awaiting := "error while LoadDirectory: duplicate device 'PLC1' in " + dir + "/dup/a.yaml and " + dir + "/dup/b.yaml"
+	_, err = Load(dir+"/dup", logger)
+	if err != nil && err.Error() == awaiting {
+		t.Log("Load() : Merge Test 2 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 2 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: glob pattern
+	// ---------------------------------------------------------------------------
+	config, err = Load(dir+"/conf.d/*.yml", logger)
+	if err == nil && len(config.Devices) == 1 && config.Devices["PLC2"] != nil {
+		t.Log("Load() : Merge Test 3 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 3 FAILED, error: %v, config: %+v", err, config)
+	}
+
+	_, err = Load(dir+"/conf.d/*.json", logger)
+	if err != nil && err.Error() == "no files match pattern '"+dir+"/conf.d/*.json'" {
+		t.Log("Load() : Merge Test 4 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 4 FAILED, error: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: recursive includes, relative to the including file, loaded once
+	// ---------------------------------------------------------------------------
+	config, err = Load(dir+"/main.yaml", logger)
+	if err == nil && len(config.Devices) == 3 && config.Devices["PLC3"].File == dir+"/extra/d.yaml" {
+		t.Log("Load() : Merge Test 5 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 5 FAILED, error: %v, config: %+v", err, config)
+	}
+
+	awaiting = "error including '" + dir + "/nowhere.yaml' from " + dir + "/missing.yaml: error while os.Stat: stat " + dir + "/nowhere.yaml: no such file or directory"
+	_, err = Load(dir+"/missing.yaml", logger)
+	if err != nil && err.Error() == awaiting {
+		t.Log("Load() : Merge Test 6 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 6 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device with no settings names its file
+	// ---------------------------------------------------------------------------
+	awaiting = "empty device 'PLC2' in " + dir + "/empty.yaml"
+	_, err = Load(dir+"/empty.yaml", logger)
+	if err != nil && strings.HasSuffix(err.Error(), awaiting) {
+		t.Log("Load() : Merge Test 7 PASSED.")
+	} else {
+		t.Errorf("Load() : Merge Test 7 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+// Functions declaration section -----------------------------------------------
+
+// ResolveProfiles expands 'device_profile' of every device in the given Config:
+// profile registers come first, device registers of the same name override
+// them in place and the others extend them. Device labels take precedence over
+// profile labels. Devices of unknown profiles are left as they are, to be
+// reported by validation.
+func ResolveProfiles(config *structures.Config) {
+
+	for _, params := range config.Devices {
+
+		if params == nil || params.DeviceProfile == "" {
+			continue
+		}
+		profile, ok := config.Profiles[params.DeviceProfile]
+		if !ok {
+			continue
+		}
+		if profile == nil {
+			profile = &structures.Profile{}
+		}
+
+		overrides := make(map[string]int, len(params.DeviceRegisters))
+		for each, register := range params.DeviceRegisters {
+			overrides[register.RegisterName] = each
+		}
+
+		registers := make([]structures.Register, 0, len(profile.ProfileRegisters)+len(params.DeviceRegisters))
+		overridden := make(map[string]bool, len(overrides))
+
+		for _, register := range profile.ProfileRegisters {
+			if each, ok := overrides[register.RegisterName]; ok {
+				register = params.DeviceRegisters[each]
+				overridden[register.RegisterName] = true
+			}
+			registers = append(registers, register)
+		}
+		for _, register := range params.DeviceRegisters {
+			if !overridden[register.RegisterName] {
+				registers = append(registers, register)
+			}
+		}
+		params.DeviceRegisters = registers
+
+		if len(profile.ProfileLabels) > 0 {
+			labels := make(map[string]string, len(profile.ProfileLabels)+len(params.DeviceLabels))
+			for k, v := range profile.ProfileLabels {
+				labels[k] = v
+			}
+			for k, v := range params.DeviceLabels {
+				labels[k] = v
+			}
+			params.DeviceLabels = labels
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestResolveProfiles(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	input := "" +
+		"profiles:\n" +
+		"  pm5560:\n" +
+		"    profile_labels:\n" +
+		"      vendor: Schneider\n" +
+		"      model: PM5560\n" +
+		"    profile_registers:\n" +
+		"      - register_name: U_A\n" +
+		"        register_si_name: voltage\n" +
+		"        register_type: float32\n" +
+		"        register_address: dec#3028\n" +
+		"        register_func_code: FC3\n" +
+		"      - register_name: U_B\n" +
+		"        register_si_name: voltage\n" +
+		"        register_type: float32\n" +
+		"        register_address: dec#3030\n" +
+		"        register_func_code: FC3\n" +
+		"METER001:\n" +
+		"  device_profile: pm5560\n" +
+		"  device_labels:\n" +
+		"    model: PM5563\n" +
+		"  device_registers:\n" +
+		"    - register_name: U_B\n" +
+		"      register_si_name: voltage\n" +
+		"      register_type: float32\n" +
+		"      register_address: dec#3032\n" +
+		"      register_func_code: FC3\n" +
+		"    - register_name: F\n" +
+		"      register_si_name: frequency\n" +
+		"      register_type: float32\n" +
+		"      register_address: dec#3110\n" +
+		"      register_func_code: FC3\n" +
+		"METER002:\n" +
+		"  device_profile: pm5560\n" +
+		"  device_registers: []\n"
+
+	config, err := UnmarshallConf(input, logger)
+	if err != nil {
+		t.Fatalf("UnmarshallConf() : FAILED, %s", err)
+	}
+
+	ResolveProfiles(config)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device overrides and extends profile registers and labels
+	// ---------------------------------------------------------------------------
+	meter := config.Devices["METER001"]
+	if len(meter.DeviceRegisters) == 3 &&
+		meter.DeviceRegisters[0].RegisterName == "U_A" &&
+		meter.DeviceRegisters[1].RegisterName == "U_B" && meter.DeviceRegisters[1].RegisterAddress == "dec#3032" &&
+		meter.DeviceRegisters[2].RegisterName == "F" &&
+		meter.DeviceLabels["vendor"] == "Schneider" && meter.DeviceLabels["model"] == "PM5563" {
+		t.Log("ResolveProfiles() : Test 1 PASSED.")
+	} else {
+		t.Errorf("ResolveProfiles() : Test 1 FAILED, registers: %+v, labels: %v", meter.DeviceRegisters, meter.DeviceLabels)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device reads profile registers as they are
+	// ---------------------------------------------------------------------------
+	meter = config.Devices["METER002"]
+	if len(meter.DeviceRegisters) == 2 && meter.DeviceRegisters[1].RegisterAddress == "dec#3030" && meter.DeviceLabels["model"] == "PM5560" {
+		t.Log("ResolveProfiles() : Test 2 PASSED.")
+	} else {
+		t.Errorf("ResolveProfiles() : Test 2 FAILED, registers: %+v, labels: %v", meter.DeviceRegisters, meter.DeviceLabels)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: profiles of several files
+	// ---------------------------------------------------------------------------
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.yaml": "profiles:\n  pm5560:\n    profile_registers: []\n",
+		"b.yaml": "profiles:\n  pm5560:\n    profile_registers: []\n",
+	} {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	awaiting := "error while LoadDirectory: duplicate profile 'pm5560' in " + dir + "/a.yaml and " + dir + "/b.yaml"
+	_, err = Load(dir, logger)
+	if err != nil && err.Error() == awaiting {
+		t.Log("ResolveProfiles() : Test 3 PASSED.")
+	} else {
+		t.Errorf("ResolveProfiles() : Test 3 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/collector"
+	"github.com/NobleD5/modbus_exporter/pkg/master"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+	"github.com/NobleD5/modbus_exporter/pkg/workload"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// ValidationError is a problem of the config, located by the file, device and
+// register it is found in (empty if not applicable)
+type ValidationError struct {
+	File     string
+	Device   string
+	Register string
+	Err      error
+}
+
+// ValidationErrors lists every problem of the config
+type ValidationErrors []ValidationError
+
+// Functions declaration section -----------------------------------------------
+
+// Error implements error
+func (problem ValidationError) Error() string {
+
+	parts := make([]string, 0, 4)
+
+	if problem.File != "" {
+		parts = append(parts, problem.File)
+	}
+	if problem.Device != "" {
+		parts = append(parts, fmt.Sprintf("device '%s'", problem.Device))
+	}
+	if problem.Register != "" {
+		parts = append(parts, fmt.Sprintf("register '%s'", problem.Register))
+	}
+
+	return strings.Join(append(parts, problem.Err.Error()), ": ")
+}
+
+// Error implements error, every problem is on its own line
+func (problems ValidationErrors) Error() string {
+
+	lines := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		lines = append(lines, problem.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ValidateConf checks settings of every device and target in the given Config,
+// which are not checked by YAML decoding. Every problem found is returned as
+// ValidationErrors, nil if there are none.
+func ValidateConf(config *structures.Config, logger log.Logger) error {
+
+	var problems ValidationErrors
+
+	names := make([]string, 0, len(config.Devices))
+	for name := range config.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		params := config.Devices[name]
+		if params == nil {
+			problems = append(problems, ValidationError{Device: name, Err: fmt.Errorf("empty device definition")})
+			continue
+		}
+
+		reported := len(problems)
+
+		report := func(register string, error error) {
+			problems = append(problems, ValidationError{File: params.File, Device: name, Register: register, Err: error})
+		}
+
+		durations := []struct {
+			setting, value string
+			zeroAllowed    bool
+		}{
+			{"device_timeout", params.DeviceTimeout, false},
+			{"device_request_delay", params.DeviceRequestDelay, true},
+			{"device_idle_timeout", params.DeviceIdleTimeout, false},
+			{"device_poll_interval", params.DevicePollInterval, false},
+		}
+
+		for _, duration := range durations {
+			error := validateDuration(duration.value, duration.zeroAllowed)
+			if error != nil {
+				report("", fmt.Errorf("invalid %s '%s': %s", duration.setting, duration.value, error.Error()))
+			}
+		}
+
+		if (params.DevicePollInterval == "") != (len(params.DevicePollTargets) == 0) {
+			report("", fmt.Errorf("device_poll_interval and device_poll_targets must be set together"))
+		}
+
+		error := master.CheckTransport(params.DeviceTransport, params.DeviceParity)
+		if error != nil {
+			report("", error)
+		}
+
+		_, error = workload.ParseHoles(params.DeviceRegisterHoles)
+		if error != nil {
+			report("", error)
+		}
+
+		error = master.CheckIdentification(params.DeviceReadIdentification, params.DeviceTransport)
+		if error != nil {
+			report("", error)
+		}
+
+		if _, ok := config.Profiles[params.DeviceProfile]; params.DeviceProfile != "" && !ok {
+			report("", fmt.Errorf("unknown device_profile '%s'", params.DeviceProfile))
+		}
+
+		for _, error := range validateLabels(params.DeviceLabels) {
+			report("", fmt.Errorf("device_labels: %s", error.Error()))
+		}
+
+		for _, register := range params.DeviceRegisters {
+			for _, error := range validateRegister(register, params.DeviceZeroBasedAddressing) {
+				report(register.RegisterName, error)
+			}
+		}
+
+		// Every unit is read once
+		units := make(map[byte]bool, len(params.DeviceUnits))
+		for _, unit := range params.DeviceUnits {
+
+			if units[unit.UnitModbusID] {
+				report("", fmt.Errorf("duplicate unit modbus id '%d'", unit.UnitModbusID))
+			}
+			units[unit.UnitModbusID] = true
+
+			for _, error := range validateLabels(unit.UnitLabels) {
+				report("", fmt.Errorf("unit %d: unit_labels: %s", unit.UnitModbusID, error.Error()))
+			}
+			for _, register := range unit.UnitRegisters {
+				for _, error := range validateRegister(register, params.DeviceZeroBasedAddressing) {
+					report(register.RegisterName, fmt.Errorf("unit %d: %s", unit.UnitModbusID, error.Error()))
+				}
+			}
+		}
+
+		// Series of the same metric must be alike, once registers are valid
+		if len(problems) == reported {
+			for _, problem := range validateFamilies(params, logger) {
+				report(problem.Register, problem.Err)
+			}
+		}
+	}
+
+	// Every target is bound to a known config, and scraped once
+	bound := make(map[[2]string]bool, len(config.Targets))
+	for each, target := range config.Targets {
+
+		key := [2]string{target.Target, target.Config}
+		reported := len(problems)
+
+		report := func(error error) {
+			problems = append(problems, ValidationError{File: target.File, Err: error})
+		}
+
+		var error error
+
+		params, ok := config.Devices[target.Config]
+		switch {
+		case target.Target == "":
+			error = fmt.Errorf("target #%d: target must be set", each+1)
+		case !ok:
+			error = fmt.Errorf("target '%s': unknown config '%s'", target.Target, target.Config)
+		case params == nil:
+			error = fmt.Errorf("target '%s': config '%s' is an empty device definition", target.Target, target.Config)
+		case bound[key]:
+			error = fmt.Errorf("target '%s': duplicate target of config '%s'", target.Target, target.Config)
+		}
+		if error != nil {
+			report(error)
+		}
+		bound[key] = true
+
+		// Target labels are given to every series of the target
+		for _, error := range validateLabels(target.Labels) {
+			report(fmt.Errorf("target '%s': labels: %s", target.Target, error.Error()))
+		}
+		for _, name := range []string{collector.TargetLabel, collector.ConfigLabel} {
+			if _, ok := target.Labels[name]; ok {
+				report(fmt.Errorf("target '%s': labels: label '%s' is reserved for the target", target.Target, name))
+			}
+		}
+
+		// Target labels must not collide with labels of the series, invalid
+		// configs are reported along with their devices
+		if len(problems) == reported {
+			if units, unitsError := workload.PrepareConfig(params, logger); unitsError == nil {
+				if error = collector.CheckTargetLabels(units, target.Labels); error != nil {
+					report(fmt.Errorf("target '%s': %s", target.Target, error.Error()))
+				}
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		level.Error(logger).Log("msg", "Invalid config", "file", problem.File, "device", problem.Device, "register", problem.Register, "error", problem.Err)
+	}
+
+	return problems
+}
+
+// validateRegister returns every problem of the register settings, address 0
+// has no protocol address on zero-based devices (addresses start at 1)
+func validateRegister(register structures.Register, zeroBased bool) []error {
+
+	var errors []error
+
+	if register.RegisterName == "" {
+		errors = append(errors, fmt.Errorf("register_name must be set"))
+	}
+
+	address, error := workload.ParseAddress(register.RegisterAddress)
+	if error != nil {
+		errors = append(errors, error)
+	}
+	if error == nil && zeroBased && address == 0 {
+		errors = append(errors, fmt.Errorf("address '%s' is not valid with device_zero_based_addressing", register.RegisterAddress))
+	}
+
+	error = master.CheckFuncCode(register.RegisterFuncCode)
+	if error != nil {
+		errors = append(errors, error)
+	}
+
+	error = master.CheckRegister(register.RegisterType, register.RegisterByteOrder, register.RegisterWordOrder)
+	if error != nil {
+		errors = append(errors, error)
+	}
+
+	error = workload.CheckStates(register)
+	if error != nil {
+		errors = append(errors, error)
+	}
+
+	error = workload.CheckString(register)
+	if error != nil {
+		errors = append(errors, error)
+	}
+
+	if register.RegisterScaleFactorAddress != "" {
+		error = workload.CheckScaleFactor(register)
+		if error != nil {
+			errors = append(errors, error)
+		}
+		if address, error := workload.ParseAddress(register.RegisterScaleFactorAddress); error == nil && zeroBased && address == 0 {
+			errors = append(errors, fmt.Errorf("scale factor address '%s' is not valid with device_zero_based_addressing", register.RegisterScaleFactorAddress))
+		}
+	}
+
+	// Metric name derived from si name is sanitized, explicit one is not
+	if register.RegisterMetricName != "" && !model.IsValidMetricName(model.LabelValue(register.RegisterMetricName)) {
+		errors = append(errors, fmt.Errorf("invalid register_metric_name '%s'", register.RegisterMetricName))
+	}
+
+	error = collector.CheckMetricType(register.RegisterMetricType)
+	if error != nil {
+		errors = append(errors, error)
+	}
+
+	for _, error := range validateLabels(register.RegisterLabels) {
+		errors = append(errors, fmt.Errorf("register_labels: %s", error.Error()))
+	}
+
+	return errors
+}
+
+// validateFamilies returns every register which cannot be exported along with
+// the other registers of the device, see collector.WorkloadFamilies
+func validateFamilies(params *structures.Params, logger log.Logger) ValidationErrors {
+
+	var problems ValidationErrors
+
+	units, error := workload.PrepareConfig(params, logger)
+	if error != nil {
+		return ValidationErrors{{Err: error}}
+	}
+
+	_, familyErrors := collector.WorkloadFamilies(units)
+	for _, familyError := range familyErrors {
+
+		error = familyError.Err
+		if len(params.DeviceUnits) > 0 {
+			error = fmt.Errorf("unit %d: %s", familyError.Device.ModbusID, error.Error())
+		}
+		problems = append(problems, ValidationError{Register: registerName(familyError.Register), Err: error})
+	}
+
+	return problems
+}
+
+// validateLabels returns every invalid label name, in order
+func validateLabels(labels map[string]string) []error {
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errors []error
+	for _, name := range names {
+		if !model.LabelName(name).IsValid() {
+			errors = append(errors, fmt.Errorf("invalid label name '%s'", name))
+		}
+	}
+
+	return errors
+}
+
+// validateDuration checks duration given in config, empty one means default
+func validateDuration(value string, zeroAllowed bool) error {
+
+	if value == "" {
+		return nil
+	}
+
+	duration, error := time.ParseDuration(value)
+	if error != nil {
+		return error
+	}
+
+	switch {
+	case duration < 0:
+		return fmt.Errorf("duration must not be negative")
+	case duration == 0 && !zeroAllowed:
+		return fmt.Errorf("duration must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestValidateConf(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+
+	logger = level.NewFilter(logger, level.AllowError())
+	logger = log.With(logger, "timestamp", log.DefaultTimestampUTC)
+	logger = log.With(logger, "caller", log.DefaultCaller)
+
+	testCases := []struct {
+		input    string
+		awaiting string
+	}{
+		{"PLC:\n  device_timeout: 300ms\n  device_request_delay: 0s\n  device_idle_timeout: 30s\n  device_registers: []", ""},
+		{"PLC:\n  device_registers: []", ""},
+		{"PLC:\n  device_timeout: 300\n  device_registers: []", "device 'PLC': invalid device_timeout '300': time: missing unit in duration \"300\""},
+		{"PLC:\n  device_timeout: 0s\n  device_registers: []", "device 'PLC': invalid device_timeout '0s': duration must be positive"},
+		{"PLC:\n  device_request_delay: -10ms\n  device_registers: []", "device 'PLC': invalid device_request_delay '-10ms': duration must not be negative"},
+		{"PLC:\n  device_idle_timeout: 1 min\n  device_registers: []", "device 'PLC': invalid device_idle_timeout '1 min': time: unknown unit \" min\" in duration \"1 min\""},
+		{"PLC:\n  device_poll_interval: 10s\n  device_poll_targets: [\"10.0.0.1:502\"]\n  device_registers: []", ""},
+		{"PLC:\n  device_poll_interval: 10s\n  device_registers: []", "device 'PLC': device_poll_interval and device_poll_targets must be set together"},
+		{"PLC:\n  device_poll_targets: [\"10.0.0.1:502\"]\n  device_registers: []", "device 'PLC': device_poll_interval and device_poll_targets must be set together"},
+		{"PLC:\n  device_read_identification: regular\n  device_registers: []", ""},
+		{"PLC:\n  device_zero_based_addressing: true\n  device_registers:\n    - register_name: F\n      register_address: dec#0", "device 'PLC': register 'F': address 'dec#0' is not valid with device_zero_based_addressing"},
+		{"PLC:\n  device_registers:\n    - register_name: F\n      register_address: dec#0", ""},
+		{"PLC:\n  device_read_identification: full\n  device_registers: []", "device 'PLC': unsupported device read identification 'full'"},
+		{"PLC:\n  device_transport: rtu\n  device_read_identification: basic\n  device_registers: []", "device 'PLC': device read identification 'basic' is not supported over 'rtu' transport"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n    group: dc1\n  - target: 10.0.0.2:502\n    config: PLC", ""},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC2", "target '10.0.0.1:502': unknown config 'PLC2'"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - config: PLC", "target #1: target must be set"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n  - target: 10.0.0.1:502\n    config: PLC", "target '10.0.0.1:502': duplicate target of config 'PLC'"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_address: dec#300\n      register_labels:\n        site: dc1\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n    labels:\n      site: dc2", "target '10.0.0.1:502': label 'site' is set by register 'U_A'"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n    labels:\n      unit_id: \"1\"", "target '10.0.0.1:502': label 'unit_id' is reserved for the exporter"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n    labels:\n      config: main", "target '10.0.0.1:502': labels: label 'config' is reserved for the target"},
+		{"PLC:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC\n    labels:\n      bad-name: x\n      target: main", "target '10.0.0.1:502': labels: invalid label name 'bad-name'\ntarget '10.0.0.1:502': labels: label 'target' is reserved for the target"},
+		{"PLC:\nPLC2:\n  device_registers: []\ntargets:\n  - target: 10.0.0.1:502\n    config: PLC", "device 'PLC': empty device definition\ntarget '10.0.0.1:502': config 'PLC' is an empty device definition"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_type: float32\n      register_byte_order: lit_endian\n      register_word_order: swapped\n      register_address: hex#2ee0\n      register_func_code: FC4\n      register_scale_factor_address: dec#100", ""},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_address: \"dec#abc\"", "device 'PLC': register 'U_A': strconv.ParseUint: parsing \"abc\": invalid syntax"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_address: \"300\"", "device 'PLC': register 'U_A': register address '300' must be in 'dec#NNN' or 'hex#NNN' format"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_address: \"oct#300\"", "device 'PLC': register 'U_A': register address 'oct#300' must be in 'dec#NNN' or 'hex#NNN' format"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_type: uint24\n      register_address: dec#300", "device 'PLC': register 'U_A': unsupported register type 'uint24'"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_byte_order: middle_endian\n      register_address: dec#300", "device 'PLC': register 'U_A': unsupported register byte order 'middle_endian'"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_address: dec#300\n      register_func_code: FC5", "device 'PLC': register 'U_A': unsupported function code 'FC5'"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: volt-age\n      register_address: dec#300", ""},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_metric_name: line-voltage\n      register_address: dec#300", "device 'PLC': register 'U_A': invalid register_metric_name 'line-voltage'"},
+		{"PLC:\n  device_registers:\n    - register_name: E\n      register_metric_name: energy_wh_total\n      register_metric_type: histogram\n      register_address: dec#300", "device 'PLC': register 'E': unsupported metric type 'histogram'"},
+		{"PLC:\n  device_registers:\n    - register_name: E\n      register_metric_name: energy_wh_total\n      register_metric_type: Counter\n      register_help: Energy imported.\n      register_address: dec#300", ""},
+		// States
+		{"PLC:\n  device_registers:\n    - register_name: UPS_STATUS\n      register_si_name: ups_status\n      register_type: bitfield\n      register_address: dec#300\n      register_bits:\n        0: on_battery\n        3: overload\n    - register_name: UPS_MODE\n      register_si_name: ups_mode\n      register_type: enum\n      register_address: dec#301\n      register_states:\n        0: off\n        1: standby\n        2: run", ""},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_STATUS\n      register_type: bitfield\n      register_address: dec#300", "device 'PLC': register 'UPS_STATUS': register_bits must be set for 'bitfield' register"},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_STATUS\n      register_type: bitfield\n      register_address: dec#300\n      register_bits:\n        16: fault", "device 'PLC': register 'UPS_STATUS': bit 16 is out of 16 bits of the register"},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_MODE\n      register_type: enum\n      register_address: dec#301\n      register_states:\n        0: off\n        1: run\n        2: run", "device 'PLC': register 'UPS_MODE': state 'run' is the name of values 1 and 2"},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_MODE\n      register_type: uint16\n      register_address: dec#301\n      register_states:\n        0: off", "device 'PLC': register 'UPS_MODE': register_states are supported for 'enum' registers only"},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_MODE\n      register_type: enum\n      register_scale: 0.1\n      register_address: dec#301\n      register_states:\n        0: off", "device 'PLC': register 'UPS_MODE': 'enum' register cannot be scaled"},
+		{"PLC:\n  device_labels:\n    state: active\n  device_registers:\n    - register_name: UPS_MODE\n      register_type: enum\n      register_address: dec#301\n      register_states:\n        0: off", "device 'PLC': register 'UPS_MODE': label 'state' is reserved for series of 'enum' register"},
+		{"PLC:\n  device_registers:\n    - register_name: UPS_MODE\n      register_si_name: ups\n      register_type: enum\n      register_address: dec#301\n      register_states:\n        0: off\n    - register_name: UPS_LOAD\n      register_si_name: ups\n      register_address: dec#302", "device 'PLC': register 'UPS_LOAD': metric 'modbus_ups' has labels [register_name,unit_id] but labels of register 'UPS_MODE' are [register_name,state,unit_id]"},
+		// Strings and BCD
+		{"PLC:\n  device_registers:\n    - register_name: SERIAL\n      register_si_name: serial_number\n      register_type: string\n      register_length: 10\n      register_address: dec#130\n      register_func_code: FC3\n    - register_name: E\n      register_si_name: energy\n      register_type: bcd32\n      register_address: dec#200\n      register_func_code: FC3", ""},
+		{"PLC:\n  device_registers:\n    - register_name: SERIAL\n      register_type: string\n      register_address: dec#130", "device 'PLC': register 'SERIAL': register_length of 'string' register must be 1 to 125 registers"},
+		{"PLC:\n  device_registers:\n    - register_name: SERIAL\n      register_type: string\n      register_length: 10\n      register_address: dec#130\n      register_labels:\n        value: serial", "device 'PLC': register 'SERIAL': label 'value' is reserved for series of 'string' register"},
+		// Registers of the same metric
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_address: dec#300\n      register_labels:\n        phase: A\n    - register_name: U_B\n      register_si_name: voltage\n      register_address: dec#301\n      register_labels:\n        phase: B", ""},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_address: dec#300\n      register_labels:\n        phase: A\n    - register_name: U_AB\n      register_si_name: voltage\n      register_address: dec#301\n      register_labels:\n        phases: AB", "device 'PLC': register 'U_AB': metric 'modbus_voltage' has labels [phases,register_name,unit_id] but labels of register 'U_A' are [phase,register_name,unit_id]"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_help: Phase voltage.\n      register_address: dec#300\n    - register_name: U_B\n      register_si_name: voltage\n      register_address: dec#301", "device 'PLC': register 'U_B': metric 'modbus_voltage' has help '' but help of register 'U_A' is 'Phase voltage.'"},
+		{"PLC:\n  device_registers:\n    - register_name: E_A\n      register_metric_name: energy\n      register_metric_type: counter\n      register_address: dec#300\n    - register_name: E_B\n      register_metric_name: energy\n      register_address: dec#301", "device 'PLC': register 'E_B': metric 'energy' has type '' but type of register 'E_A' is 'counter'"},
+		{"PLC:\n  device_units:\n    - unit_modbus_id: 1\n      unit_labels:\n        line: L1\n    - unit_modbus_id: 2\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_address: dec#300", "device 'PLC': register 'U_A': unit 2: metric 'modbus_voltage' has labels [register_name,unit_id] but labels of register 'U_A' are [line,register_name,unit_id]"},
+		{"PLC:\n  device_registers:\n    - register_name: U_A\n      register_si_name: voltage\n      register_address: dec#300\n      register_labels:\n        phase: A\n    - register_name: U_B\n      register_si_name: Voltage\n      register_address: dec#301\n      register_labels:\n        phase: A\n        register_name: U_A",
+			"device 'PLC': register 'U_B': duplicate series modbus_voltage{phase=\"A\",register_name=\"U_A\",unit_id=\"0\"} of register 'U_A'"},
+		{"PLC:\n  device_registers:\n    - register_name: UP\n      register_si_name: up\n      register_address: dec#300", "device 'PLC': register 'UP': metric 'modbus_up' is reserved for the exporter"},
+		// Profiles
+		{"PLC:\n  device_profile: pm5560\n  device_registers: []", "device 'PLC': unknown device_profile 'pm5560'"},
+		{"PLC:\n  device_profile: pm5560\n  device_registers: []\nprofiles:\n  pm5560:\n    profile_registers:\n      - register_name: U_A\n        register_address: dec#300", ""},
+		{"PLC:\n  device_transport: udp\n  device_registers: []", "device 'PLC': unsupported device transport 'udp'"},
+		{"PLC:\n  device_transport: rtu\n  device_parity: mark\n  device_registers: []", "device 'PLC': unsupported serial parity 'mark'"},
+		{"PLC:\n  device_labels:\n    rack-id: 1\n  device_units:\n    - unit_modbus_id: 2\n    - unit_modbus_id: 2\n  device_registers: []", "device 'PLC': device_labels: invalid label name 'rack-id'\ndevice 'PLC': duplicate unit modbus id '2'"},
+		// Every problem is reported, not only the first one
+		{"PLC:\n  device_timeout: 300\n  device_registers:\n    - register_name: U_A\n      register_type: uint24\n      register_address: dec#abc\n    - register_name: U_B\n      register_address: dec#301\n      register_word_order: reversed\nPLC2:\n  device_registers:\n    - register_address: \"dec#1\"\n", "" +
+			"device 'PLC': invalid device_timeout '300': time: missing unit in duration \"300\"\n" +
+			"device 'PLC': register 'U_A': strconv.ParseUint: parsing \"abc\": invalid syntax\n" +
+			"device 'PLC': register 'U_A': unsupported register type 'uint24'\n" +
+			"device 'PLC': register 'U_B': unsupported register word order 'reversed'\n" +
+			"device 'PLC2': register_name must be set"},
+	}
+
+	for each, testCase := range testCases {
+
+		config, err := UnmarshallConf(testCase.input, logger)
+		if err != nil {
+			t.Fatalf("UnmarshallConf() : FAILED, %s", err)
+		}
+
+		err = ValidateConf(config, logger)
+		if err == nil && testCase.awaiting == "" || err != nil && err.Error() == testCase.awaiting {
+			t.Logf("ValidateConf() : Test %d PASSED, error: %v", each+1, err)
+		} else {
+			t.Errorf("ValidateConf() : Test %d FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", each+1, testCase.awaiting, err)
+		}
+	}
+
+}
+
+func TestLoadInvalid(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml": "PLC1:\n  device_registers:\n    - register_name: U_A\n      register_address: dec#300\n",
+		"b.yaml": "PLC2:\n  device_request_delay: 1 s\n  device_registers:\n    - register_name: U_B\n      register_address: dec300\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: problems are reported with the file they are found in
+	// ---------------------------------------------------------------------------
+	awaiting := "error validating config: " +
+		dir + "/b.yaml: device 'PLC2': invalid device_request_delay '1 s': time: unknown unit \" s\" in duration \"1 s\"\n" +
+		dir + "/b.yaml: device 'PLC2': register 'U_B': register address 'dec300' must be in 'dec#NNN' or 'hex#NNN' format"
+
+	_, err := Load(dir, logger)
+	if err != nil && err.Error() == awaiting {
+		t.Log("Load() : Test 1 PASSED.")
+	} else {
+		t.Errorf("Load() : Test 1 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: valid file of the same directory is loaded
+	// ---------------------------------------------------------------------------
+	config, err := Load(dir+"/a.yaml", logger)
+	if err == nil && config.Devices["PLC1"].File == dir+"/a.yaml" {
+		t.Log("Load() : Test 2 PASSED.")
+	} else {
+		t.Errorf("Load() : Test 2 FAILED, error: %v", err)
+	}
+
+}
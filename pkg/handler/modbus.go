@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/NobleD5/modbus_exporter/pkg/collector"
+	"github.com/NobleD5/modbus_exporter/pkg/poller"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 	"github.com/NobleD5/modbus_exporter/pkg/workload"
 
@@ -14,11 +17,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Modbus serves the modbus page.
+// Modbus serves the modbus page. Targets polled in background by the poller
+// (if given) are served from its cache.
 //
 // The returned handler is already instrumented for Prometheus.
 func Modbus(
 	safeConfig *structures.SafeConfig,
+	modbusPoller *poller.Poller,
 	logger log.Logger,
 ) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +65,7 @@ func Modbus(
 
 		//
 		safeConfig.RLock()
-		config, ok := (*(safeConfig.C))[configName]
+		config, ok := safeConfig.C.Devices[configName]
 		safeConfig.RUnlock()
 		if !ok {
 			level.Error(logger).Log("msg", "Unknown", "config", configName)
@@ -75,16 +80,28 @@ func Modbus(
 		)
 
 		workload, error := workload.PrepareConfig(config, logger)
+		if error == nil {
+			error = collector.CheckWorkload(workload)
+		}
 		if error != nil {
 			level.Error(logger).Log("msg", "Error preparing workload", "error", error.Error())
 			http.Error(w, "error preparing workload", http.StatusBadRequest)
 			return
 		}
 
+		ctx, cancel := scrapeContext(r, logger)
+		defer cancel()
+
 		start := time.Now()
 		registry := prometheus.NewRegistry()
-		modbusCollector := collector.NewModbusCollector(target, workload, logger)
-		registry.MustRegister(modbusCollector)
+		modbusCollector := newCollector(ctx, target, configName, workload, modbusPoller, logger)
+		error = registry.Register(modbusCollector)
+		if error != nil {
+			level.Error(logger).Log("msg", "Error registering collector", "error", error.Error())
+			http.Error(w, "error registering collector: "+error.Error(), http.StatusInternalServerError)
+			modbusRequestErrors.Inc()
+			return
+		}
 
 		// Delegate http serving to Prometheus client library, which will call collector.Collect.
 		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
@@ -102,3 +119,45 @@ func Modbus(
 	})
 
 }
+
+// scrapeContext returns context of the scrape request, limited by the scrape
+// timeout of Prometheus as it gives up on the scrape after
+func scrapeContext(r *http.Request, logger log.Logger) (context.Context, context.CancelFunc) {
+
+	timeout := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if timeout == "" {
+		return context.WithCancel(r.Context())
+	}
+
+	seconds, error := strconv.ParseFloat(timeout, 64)
+	if error != nil || seconds <= 0 {
+		level.Warn(logger).Log("msg", "Ignoring invalid scrape timeout", "timeout", timeout)
+		return context.WithCancel(r.Context())
+	}
+
+	return context.WithTimeout(r.Context(), time.Duration(seconds*float64(time.Second)))
+}
+
+// newCollector returns collector of the target, serving polled values of the
+// target (if any) instead of scraping it
+func newCollector(
+	ctx context.Context,
+	target string,
+	configName string,
+	workload map[structures.Device]structures.Registers,
+	modbusPoller *poller.Poller,
+	logger log.Logger,
+) *collector.Collector {
+
+	modbusCollector := collector.NewModbusCollector(target, workload, logger)
+	modbusCollector.Context = ctx
+
+	if modbusPoller != nil {
+		if result, ok := modbusPoller.Result(configName, target); ok {
+			level.Debug(logger).Log("msg", "Serving polled target", "target", target, "config", configName, "polled_at", result.Time)
+			modbusCollector.Cache = result
+		}
+	}
+
+	return modbusCollector
+}
@@ -1,14 +1,18 @@
 package handler
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/NobleD5/modbus_exporter/pkg/config"
 	"github.com/NobleD5/modbus_exporter/pkg/logger"
+	"github.com/NobleD5/modbus_exporter/pkg/poller"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
 	"github.com/go-kit/kit/log"
@@ -43,7 +47,7 @@ func TestModbus(t *testing.T) {
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/modbus", Modbus(safeConfig, logger).ServeHTTP)
+	mux.HandleFunc("/modbus", Modbus(safeConfig, nil, logger).ServeHTTP)
 
 	// mux.HandleFunc("/", func(res http.ResponseWriter, req *http.Request) {
 	// 	// res.Header().Set("Content-Type", "application/json")
@@ -58,6 +62,7 @@ func TestModbus(t *testing.T) {
 	modbusNoTargRoute, _ := url.Parse(ts.URL + "/modbus")
 	modbusNoConfRoute, _ := url.Parse(ts.URL + "/modbus?target=localhost%3A2102")
 	modbusUnkConfRoute, _ := url.Parse(ts.URL + "/modbus?config=PLC&target=localhost%3A2102")
+	modbusDownRoute, _ := url.Parse(ts.URL + "/modbus" + "?config=PLC001&target=localhost%3A2109")
 
 	// Test 1 --------------------------------------------------------------------
 	resp, err := http.Get(modbusValidRoute.String())
@@ -91,4 +96,110 @@ func TestModbus(t *testing.T) {
 		t.Logf("Modbus() : Test 4 PASSED, expected %d and got status code: %d", http.StatusBadRequest, resp.StatusCode)
 	}
 
+	// Test 5 --------------------------------------------------------------------
+	resp, err = http.Get(modbusDownRoute.String())
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Modbus() : Test 5 FAILED, error: %v, expected status code: 200, got: %d", err, resp.StatusCode)
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), "modbus_scrape_success 0") {
+			t.Logf("Modbus() : Test 5 PASSED, expected %d and got status code: %d", http.StatusOK, resp.StatusCode)
+		} else {
+			t.Errorf("Modbus() : Test 5 FAILED, awaiting 'modbus_scrape_success 0', got: %s", body)
+		}
+	}
+
+	// Test 6 --------------------------------------------------------------------
+	request, _ := http.NewRequest(http.MethodGet, modbusDownRoute.String(), nil)
+	request.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "0.000001")
+	resp, err = http.DefaultClient.Do(request)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Modbus() : Test 6 FAILED, error: %v, expected status code: 200", err)
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), `reason="timeout",unit_id="1"} 1`) {
+			t.Logf("Modbus() : Test 6 PASSED, scrape exceeding its deadline is rejected")
+		} else {
+			t.Errorf("Modbus() : Test 6 FAILED, awaiting timeout failure, got: %s", body)
+		}
+	}
+
+	// Test 7 --------------------------------------------------------------------
+	// Registers of the same metric with different label names are rejected
+	safeConfig.Lock()
+	safeConfig.C.Devices["COLLIDING"] = &structures.Params{
+		DeviceRegisters: []structures.Register{
+			*structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#300", "FC3", map[string]string{"phase": "A"}),
+			*structures.NewRegister("U_AB", "voltage", "uint16", "", "", "dec#301", "FC3", map[string]string{"line": "AB"}),
+		},
+	}
+	safeConfig.Unlock()
+
+	resp, err = http.Get(ts.URL + "/modbus?config=COLLIDING&target=localhost%3A2102")
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Modbus() : Test 7 FAILED, error: %v, expected status code: 400", err)
+	} else {
+		t.Logf("Modbus() : Test 7 PASSED, expected %d and got status code: %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// Test 8 --------------------------------------------------------------------
+	// Device defined with no settings is rejected
+	safeConfig.Lock()
+	safeConfig.C.Devices["EMPTY"] = nil
+	safeConfig.Unlock()
+
+	resp, err = http.Get(ts.URL + "/modbus?config=EMPTY&target=localhost%3A2102")
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Modbus() : Test 8 FAILED, error: %v, expected status code: 400", err)
+	} else {
+		t.Logf("Modbus() : Test 8 PASSED, expected %d and got status code: %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+}
+
+func TestModbusPolled(t *testing.T) {
+
+	logger := logger.SetupLogger("DEBUG")
+
+	loaded, err := config.Load("../testdata/valid_modbus_conf.yaml", logger)
+	if err != nil {
+		t.Fatalf("config.Load() : FAILED, %s", err)
+	}
+
+	params := *loaded.Devices["PLC001"]
+	params.DevicePollInterval = "1s"
+	params.DevicePollTargets = []string{"localhost:2102"}
+
+	safeConfig := structures.NewSafeConfig(&structures.Config{Devices: map[string]*structures.Params{"PLC001": &params}})
+
+	modbusPoller := poller.New(safeConfig, logger)
+	modbusPoller.Start()
+	defer modbusPoller.Stop()
+
+	for i := 0; i < 300; i++ {
+		if _, ok := modbusPoller.Result("PLC001", "localhost:2102"); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/modbus", Modbus(safeConfig, modbusPoller, logger).ServeHTTP)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Test 1 --------------------------------------------------------------------
+	resp, err := http.Get(ts.URL + "/modbus?config=PLC001&target=localhost%3A2102")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Modbus() : Polled Test 1 FAILED, error: %v", err)
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), "modbus_poll_stale 0") {
+			t.Log("Modbus() : Polled Test 1 PASSED, polled target is served from cache")
+		} else {
+			t.Errorf("Modbus() : Polled Test 1 FAILED, awaiting 'modbus_poll_stale 0', got: %s", body)
+		}
+	}
+
 }
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// sdTargetGroup is the target group of Prometheus HTTP service discovery
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Functions declaration section -----------------------------------------------
+
+// ServiceDiscovery serves targets of the config ('targets' section and
+// 'device_poll_targets') in Prometheus HTTP service discovery format. Every
+// target is scraped from the exporter at address (host of the request, if
+// empty) on metricsPath, with the device and target labels. Unknown 'group'
+// parameter is rejected as by Targets.
+func ServiceDiscovery(
+	safeConfig *structures.SafeConfig,
+	address string,
+	metricsPath string,
+	logger log.Logger,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		group := r.URL.Query().Get("group")
+
+		exporter := address
+		if exporter == "" {
+			exporter = r.Host
+		}
+
+		safeConfig.RLock()
+		targets := configuredTargets(safeConfig.C)
+		devices := safeConfig.C.Devices
+		safeConfig.RUnlock()
+
+		groups := make([]sdTargetGroup, 0, len(targets))
+
+		for _, target := range targets {
+
+			if group != "" && target.Group != group {
+				continue
+			}
+
+			labels := make(map[string]string)
+			if config, ok := devices[target.Config]; ok {
+				for k, v := range config.DeviceLabels {
+					labels[k] = v
+				}
+			}
+			for k, v := range target.Labels {
+				labels[k] = v
+			}
+			labels["instance"] = target.Target
+			labels["__metrics_path__"] = metricsPath
+			labels["__param_target"] = target.Target
+			labels["__param_config"] = target.Config
+
+			groups = append(groups, sdTargetGroup{Targets: []string{exporter}, Labels: labels})
+		}
+
+		if group != "" && len(groups) == 0 {
+			level.Error(logger).Log("msg", "Unknown", "group", group)
+			http.Error(w, "unknown group", http.StatusBadRequest)
+			return
+		}
+
+		content, error := json.Marshal(groups)
+		if error != nil {
+			level.Error(logger).Log("msg", "Error marshalling service discovery targets", "err", error.Error())
+			http.Error(w, error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+
+	})
+}
+
+// configuredTargets returns targets of the 'targets' section followed by the
+// polled ones, every target of a config once
+func configuredTargets(config *structures.Config) []structures.Target {
+
+	targets := make([]structures.Target, 0, len(config.Targets))
+	seen := make(map[[2]string]bool)
+
+	for _, target := range config.Targets {
+		seen[[2]string{target.Target, target.Config}] = true
+		targets = append(targets, target)
+	}
+
+	for _, name := range sortedNames(config.Devices) {
+		for _, address := range config.Devices[name].DevicePollTargets {
+			if !seen[[2]string{address, name}] {
+				seen[[2]string{address, name}] = true
+				targets = append(targets, structures.Target{Target: address, Config: name})
+			}
+		}
+	}
+
+	return targets
+}
+
+// sortedNames returns names of the configs in order
+func sortedNames(devices map[string]*structures.Params) []string {
+
+	names := make([]string, 0, len(devices))
+	for name, params := range devices {
+		if params != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
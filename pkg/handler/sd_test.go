@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/logger"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+func TestServiceDiscovery(t *testing.T) {
+
+	logger := logger.SetupLogger("DEBUG")
+
+	safeConfig := structures.NewSafeConfig(&structures.Config{
+		Devices: map[string]*structures.Params{
+			"PLC": {
+				DeviceLabels:       map[string]string{"vendor": "foo", "location": "dc1"},
+				DevicePollInterval: "10s",
+				DevicePollTargets:  []string{"10.0.0.1:502", "10.0.0.3:502"},
+			},
+			"METER": {},
+		},
+		Targets: []structures.Target{
+			{Target: "10.0.0.1:502", Config: "PLC", Group: "dc1", Labels: map[string]string{"location": "dc1/rack7"}},
+			{Target: "10.0.0.2:502", Config: "METER", Group: "dc2"},
+		},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sd", ServiceDiscovery(safeConfig, "exporter:9700", "/modbus", logger).ServeHTTP)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	testCases := []struct {
+		query    string
+		status   int
+		awaiting []sdTargetGroup
+	}{
+		{
+			"",
+			http.StatusOK,
+			[]sdTargetGroup{
+				{
+					Targets: []string{"exporter:9700"},
+					Labels: map[string]string{
+						"vendor": "foo", "location": "dc1/rack7", "instance": "10.0.0.1:502",
+						"__metrics_path__": "/modbus", "__param_target": "10.0.0.1:502", "__param_config": "PLC",
+					},
+				},
+				{
+					Targets: []string{"exporter:9700"},
+					Labels: map[string]string{
+						"instance":         "10.0.0.2:502",
+						"__metrics_path__": "/modbus", "__param_target": "10.0.0.2:502", "__param_config": "METER",
+					},
+				},
+				{
+					Targets: []string{"exporter:9700"},
+					Labels: map[string]string{
+						"vendor": "foo", "location": "dc1", "instance": "10.0.0.3:502",
+						"__metrics_path__": "/modbus", "__param_target": "10.0.0.3:502", "__param_config": "PLC",
+					},
+				},
+			},
+		},
+		{
+			"?group=dc2",
+			http.StatusOK,
+			[]sdTargetGroup{
+				{
+					Targets: []string{"exporter:9700"},
+					Labels: map[string]string{
+						"instance":         "10.0.0.2:502",
+						"__metrics_path__": "/modbus", "__param_target": "10.0.0.2:502", "__param_config": "METER",
+					},
+				},
+			},
+		},
+		{"?group=unknown", http.StatusBadRequest, nil},
+	}
+
+	for each, testCase := range testCases {
+
+		var groups []sdTargetGroup
+
+		resp, err := http.Get(ts.URL + "/sd" + testCase.query)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&groups)
+		}
+
+		if err == nil && resp.StatusCode == testCase.status && reflect.DeepEqual(groups, testCase.awaiting) &&
+			(testCase.status != http.StatusOK || resp.Header.Get("Content-Type") == "application/json") {
+			t.Logf("ServiceDiscovery() : Test %d PASSED, query '%s'", each+1, testCase.query)
+		} else {
+			t.Errorf("ServiceDiscovery() : Test %d FAILED, query '%s', error: %v, \nawaiting: %v, \ngot: %v", each+1, testCase.query, err, testCase.awaiting, groups)
+		}
+	}
+
+}
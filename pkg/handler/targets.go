@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/collector"
+	"github.com/NobleD5/modbus_exporter/pkg/poller"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+	"github.com/NobleD5/modbus_exporter/pkg/workload"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// boundedCollector collects the target when one of the slots is free
+type boundedCollector struct {
+	*collector.Collector
+	slots chan struct{}
+}
+
+// Functions declaration section -----------------------------------------------
+
+// Targets serves the targets page, i.e. scrapes every target of the 'targets'
+// config section (or the targets of the 'group' parameter) in a single request.
+// Targets are scraped concurrently, no more than parallel of them at once,
+// their series get 'target' and 'config' labels along with target labels.
+func Targets(
+	safeConfig *structures.SafeConfig,
+	modbusPoller *poller.Poller,
+	parallel int,
+	logger log.Logger,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		group := r.URL.Query().Get("group")
+
+		safeConfig.RLock()
+		targets := safeConfig.C.Targets
+		devices := safeConfig.C.Devices
+		safeConfig.RUnlock()
+
+		selected := make([]structures.Target, 0, len(targets))
+		for _, target := range targets {
+			if group == "" || target.Group == group {
+				selected = append(selected, target)
+			}
+		}
+		if group != "" && len(selected) == 0 {
+			level.Error(logger).Log("msg", "Unknown", "group", group)
+			http.Error(w, "unknown group", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := scrapeContext(r, logger)
+		defer cancel()
+
+		if parallel < 1 {
+			parallel = 1
+		}
+		slots := make(chan struct{}, parallel)
+
+		start := time.Now()
+		registry := prometheus.NewRegistry()
+
+		for _, target := range selected {
+
+			targetLogger := log.With(logger, "target", target.Target, "config", target.Config)
+
+			// Targets are validated at load
+			config, ok := devices[target.Config]
+			if !ok {
+				level.Error(targetLogger).Log("msg", "Unknown config of target")
+				continue
+			}
+
+			workload, error := workload.PrepareConfig(config, targetLogger)
+			if error == nil {
+				error = collector.CheckWorkload(workload)
+			}
+			if error != nil {
+				level.Error(targetLogger).Log("msg", "Error preparing workload", "error", error.Error())
+				continue
+			}
+
+			// Series with labels colliding with target labels would be dropped
+			if error = collector.CheckTargetLabels(workload, target.Labels); error != nil {
+				level.Error(targetLogger).Log("msg", "Invalid target labels", "error", error.Error())
+				continue
+			}
+
+			labels := prometheus.Labels{}
+			for k, v := range target.Labels {
+				labels[k] = v
+			}
+			labels[collector.TargetLabel] = target.Target
+			labels[collector.ConfigLabel] = target.Config
+
+			prometheus.WrapRegistererWith(labels, registry).MustRegister(boundedCollector{
+				Collector: newCollector(ctx, target.Target, target.Config, workload, modbusPoller, targetLogger),
+				slots:     slots,
+			})
+		}
+
+		// Delegate http serving to Prometheus client library, which will call collector.Collect.
+		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+		h.ServeHTTP(w, r)
+
+		level.Debug(logger).Log("msg", "Scrape of targets",
+			"group", group,
+			"targets", len(selected),
+			"duration", time.Since(start).Seconds(),
+		)
+
+	})
+}
+
+// Describe implements Prometheus.Collector. Collectors of targets describe
+// nothing (i.e. they are unchecked), as series of different targets may have
+// different labels (target labels, configs), which checked collectors of the
+// same registry cannot.
+func (bounded boundedCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements Prometheus.Collector
+func (bounded boundedCollector) Collect(ch chan<- prometheus.Metric) {
+
+	bounded.slots <- struct{}{}
+	defer func() { <-bounded.slots }()
+
+	bounded.Collector.Collect(ch)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/config"
+	"github.com/NobleD5/modbus_exporter/pkg/logger"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+func TestTargets(t *testing.T) {
+
+	logger := logger.SetupLogger("DEBUG")
+
+	loaded, err := config.Load("../testdata/valid_modbus_conf.yaml", logger)
+	if err != nil {
+		t.Fatalf("config.Load() : FAILED, %s", err)
+	}
+	loaded.Targets = []structures.Target{
+		{Target: "localhost:2102", Config: "PLC001", Group: "up"},
+		{Target: "localhost:2109", Config: "PLC001", Group: "down", Labels: map[string]string{"site": "dc2"}},
+		{Target: "localhost:2102", Config: "EMPTY", Group: "empty"},
+		{Target: "localhost:2109", Config: "PLC001", Group: "colliding", Labels: map[string]string{"unit_id": "2"}},
+	}
+	// Device defined with no settings
+	loaded.Devices["EMPTY"] = nil
+
+	safeConfig := structures.NewSafeConfig(loaded)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/targets", Targets(safeConfig, nil, 2, logger).ServeHTTP)
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	testCases := []struct {
+		query    string
+		status   int
+		contains []string
+		missing  []string
+	}{
+		{
+			"",
+			http.StatusOK,
+			[]string{
+				`modbus_up{config="PLC001",target="localhost:2102",unit_id="1"} 1`,
+				`modbus_up{config="PLC001",site="dc2",target="localhost:2109",unit_id="1"} 0`,
+			},
+			nil,
+		},
+		{
+			"?group=up",
+			http.StatusOK,
+			[]string{`modbus_up{config="PLC001",target="localhost:2102",unit_id="1"} 1`},
+			[]string{`target="localhost:2109"`},
+		},
+		{"?group=unknown", http.StatusBadRequest, nil, nil},
+		{"?group=empty", http.StatusOK, nil, []string{`config="EMPTY"`}},
+		{"?group=colliding", http.StatusOK, nil, []string{`modbus_up`}},
+	}
+
+	for each, testCase := range testCases {
+
+		resp, err := http.Get(ts.URL + "/targets" + testCase.query)
+		if err != nil || resp.StatusCode != testCase.status {
+			t.Errorf("Targets() : Test %d FAILED, error: %v, expected status code: %d", each+1, err, testCase.status)
+			continue
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		passed := true
+		for _, series := range testCase.contains {
+			passed = passed && strings.Contains(string(body), series)
+		}
+		for _, series := range testCase.missing {
+			passed = passed && !strings.Contains(string(body), series)
+		}
+
+		if passed {
+			t.Logf("Targets() : Test %d PASSED, query '%s'", each+1, testCase.query)
+		} else {
+			t.Errorf("Targets() : Test %d FAILED, query '%s', got: %s", each+1, testCase.query, body)
+		}
+	}
+
+}
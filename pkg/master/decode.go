@@ -0,0 +1,169 @@
+package master
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Constants declaration section -----------------------------------------------
+const (
+	normal = "normal"
+	none   = "none"
+
+	littleEndian = "little_endian"
+)
+
+// Functions declaration section -----------------------------------------------
+
+// decode converts raw registers (as received, 2 bytes per register) into the
+// value of the data type. Word order is applied first and byte order after it,
+// so both orders are independent of each other and of the data type width:
+//
+//	word order 'normal'   : registers are taken as received (default)
+//	word order 'swapped'  : registers are taken in reverse order
+//	word order 'mirrored' : all bytes are taken in reverse order
+//	byte order 'big_endian' : most significant byte first (default)
+//	byte order 'lit_endian' : least significant byte first
+//
+// E.g. for a 32-bit value with bytes ABCD, wire order is ABCD for big_endian,
+// CDAB for big_endian swapped, DCBA for lit_endian and BADC for lit_endian
+// swapped.
+func decode(raw []byte, regType, byteOrder, wordOrder string) (float64, error) {
+
+	length := 2 * int(registerLength(regType))
+	if len(raw) != length {
+		return 0, fmt.Errorf("register type '%s' needs %d bytes, got %d", regType, length, len(raw))
+	}
+
+	data, error := orderBytes(raw, byteOrder, wordOrder)
+	if error != nil {
+		return 0, error
+	}
+
+	switch strings.ToLower(regType) {
+	case tWord, tUint16, TypeBitfield, TypeEnum:
+		return float64(binary.BigEndian.Uint16(data)), nil
+	case tInt16:
+		return float64(int16(binary.BigEndian.Uint16(data))), nil
+	case tDWord, tUint32:
+		return float64(binary.BigEndian.Uint32(data)), nil
+	case tInt32:
+		return float64(int32(binary.BigEndian.Uint32(data))), nil
+	case tFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case tUint64:
+		return float64(binary.BigEndian.Uint64(data)), nil
+	case tInt64:
+		return float64(int64(binary.BigEndian.Uint64(data))), nil
+	case tFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case tBCD16, tBCD32:
+		return decodeBCD(data)
+	default:
+		// Unknown types are read as a single unsigned register, as before
+		return float64(binary.BigEndian.Uint16(data)), nil
+	}
+}
+
+// CheckRegister checks data type and orders of the register given in config,
+// empty ones mean defaults
+func CheckRegister(regType, byteOrder, wordOrder string) error {
+
+	switch strings.ToLower(regType) {
+	case "", tWord, tDWord, tUint16, tUint32, tInt16, tInt32, tUint64, tInt64, tFloat32, tFloat64, TypeBitfield, TypeEnum, tBCD16, tBCD32, TypeString:
+	default:
+		return fmt.Errorf("unsupported register type '%s'", regType)
+	}
+
+	_, error := orderBytes(make([]byte, 2), byteOrder, wordOrder)
+
+	return error
+}
+
+// decodeBCD converts binary coded decimal (two digits per byte, most significant
+// digit first) into its value
+func decodeBCD(data []byte) (float64, error) {
+
+	value := 0.0
+
+	for _, b := range data {
+		for _, digit := range []byte{b >> 4, b & 0x0F} {
+			if digit > 9 {
+				return 0, fmt.Errorf("invalid BCD digit %X in % x", digit, data)
+			}
+			value = value*10 + float64(digit)
+		}
+	}
+
+	return value, nil
+}
+
+// decodeString converts raw registers into ASCII text, two characters per
+// register, first character in the most significant byte ('big_endian') or in
+// the least significant one ('lit_endian'). Text ends at the first NUL, trailing
+// spaces (padding) are trimmed and bytes which are not UTF-8 are replaced.
+func decodeString(raw []byte, byteOrder string) (string, error) {
+
+	data := make([]byte, len(raw))
+	copy(data, raw)
+
+	switch strings.ToLower(byteOrder) {
+	case "", bigEndian:
+	case litEndian, littleEndian:
+		for i := 0; i+1 < len(data); i += 2 {
+			data[i], data[i+1] = data[i+1], data[i]
+		}
+	default:
+		return "", fmt.Errorf("unsupported register byte order '%s'", byteOrder)
+	}
+
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+
+	return strings.ToValidUTF8(strings.TrimRight(string(data), " "), "\uFFFD"), nil
+}
+
+// orderBytes returns a copy of raw registers rearranged into big endian
+// (most significant byte first) order, for data of any width.
+func orderBytes(raw []byte, byteOrder, wordOrder string) ([]byte, error) {
+
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("registers data must have even length, got %d", len(raw))
+	}
+
+	data := make([]byte, len(raw))
+	copy(data, raw)
+
+	switch strings.ToLower(wordOrder) {
+	case "", normal, none:
+	case swapped:
+		for i, j := 0, len(data)-2; i < j; i, j = i+2, j-2 {
+			data[i], data[i+1], data[j], data[j+1] = data[j], data[j+1], data[i], data[i+1]
+		}
+	case mirrored:
+		reverse(data)
+	default:
+		return nil, fmt.Errorf("unsupported register word order '%s'", wordOrder)
+	}
+
+	switch strings.ToLower(byteOrder) {
+	case "", bigEndian:
+	case litEndian, littleEndian:
+		reverse(data)
+	default:
+		return nil, fmt.Errorf("unsupported register byte order '%s'", byteOrder)
+	}
+
+	return data, nil
+}
+
+// reverse reverses order of bytes in place
+func reverse(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
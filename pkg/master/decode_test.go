@@ -0,0 +1,163 @@
+package master
+
+import (
+	"testing"
+)
+
+// Byte layouts on the wire for every byte/word order combination, letters
+// stand for bytes of the value from the most significant one ('A') onwards.
+var orderLayouts = []struct {
+	byteOrder, wordOrder string
+	layouts              map[int]string
+}{
+	{"big_endian", "", map[int]string{2: "AB", 4: "ABCD", 8: "ABCDEFGH", 10: "ABCDEFGHIJ"}},
+	{"big_endian", "swapped", map[int]string{2: "AB", 4: "CDAB", 8: "GHEFCDAB", 10: "IJGHEFCDAB"}},
+	{"big_endian", "mirrored", map[int]string{2: "BA", 4: "DCBA", 8: "HGFEDCBA", 10: "JIHGFEDCBA"}},
+	{"lit_endian", "", map[int]string{2: "BA", 4: "DCBA", 8: "HGFEDCBA", 10: "JIHGFEDCBA"}},
+	{"lit_endian", "swapped", map[int]string{2: "BA", 4: "BADC", 8: "BADCFEHG", 10: "BADCFEHGJI"}},
+	{"lit_endian", "mirrored", map[int]string{2: "AB", 4: "ABCD", 8: "ABCDEFGH", 10: "ABCDEFGHIJ"}},
+}
+
+// layout arranges value bytes (most significant first) as described by pattern
+func layout(value []byte, pattern string) []byte {
+
+	wire := make([]byte, len(pattern))
+	for i, letter := range pattern {
+		wire[i] = value[letter-'A']
+	}
+	return wire
+}
+
+func TestOrderBytes(t *testing.T) {
+
+	value := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	for each, set := range orderLayouts {
+		for length, pattern := range set.layouts {
+
+			data, err := orderBytes(layout(value, pattern), set.byteOrder, set.wordOrder)
+			if err == nil && string(data) == string(value[:length]) {
+				t.Logf("orderBytes() : Test %d PASSED, %s %s %d bytes", each+1, set.byteOrder, set.wordOrder, length)
+			} else {
+				t.Errorf("orderBytes() : Test %d FAILED, %s %s %d bytes, got % x, error: %v", each+1, set.byteOrder, set.wordOrder, length, data, err)
+			}
+		}
+	}
+
+	// Odd length and unknown orders must be rejected
+	invalid := []struct {
+		data                 []byte
+		byteOrder, wordOrder string
+	}{
+		{[]byte{1, 2, 3}, "big_endian", ""},
+		{[]byte{1, 2}, "middle_endian", ""},
+		{[]byte{1, 2}, "big_endian", "shuffled"},
+	}
+
+	for each, set := range invalid {
+		if _, err := orderBytes(set.data, set.byteOrder, set.wordOrder); err != nil {
+			t.Logf("orderBytes() : Test %d PASSED, got error: %s", len(orderLayouts)+each+1, err)
+		} else {
+			t.Errorf("orderBytes() : Test %d FAILED, awaiting error", len(orderLayouts)+each+1)
+		}
+	}
+
+}
+
+func TestDecode(t *testing.T) {
+
+	// Values are given most significant byte first
+	types := []struct {
+		regType  string
+		value    []byte
+		awaiting float64
+	}{
+		{"word", []byte{0x12, 0x34}, 0x1234},
+		{"uint16", []byte{0xFF, 0xF6}, 65526},
+		{"int16", []byte{0xFF, 0xF6}, -10},
+		{"dword", []byte{0x00, 0x01, 0x05, 0x69}, 66921},
+		{"uint32", []byte{0xFF, 0xFF, 0xFF, 0xF6}, 4294967286},
+		{"int32", []byte{0xFF, 0xFF, 0xFF, 0xF6}, -10},
+		{"float32", []byte{0x43, 0x66, 0x80, 0x00}, 230.5},
+		{"uint64", []byte{0, 0, 0, 1, 0, 0, 0, 2}, 1<<32 + 2},
+		{"int64", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF6}, -10},
+		{"float64", []byte{0x40, 0x6C, 0xD0, 0, 0, 0, 0, 0}, 230.5},
+		{"INT16", []byte{0x80, 0x00}, -32768},
+		{"bitfield", []byte{0x80, 0x09}, 0x8009},
+		{"enum", []byte{0x00, 0x02}, 2},
+		{"bcd16", []byte{0x12, 0x34}, 1234},
+		{"bcd32", []byte{0x00, 0x98, 0x76, 0x54}, 987654},
+	}
+
+	test := 0
+	for _, typ := range types {
+		for _, order := range orderLayouts {
+
+			test++
+			wire := layout(typ.value, order.layouts[len(typ.value)])
+
+			r, err := decode(wire, typ.regType, order.byteOrder, order.wordOrder)
+			if err == nil && r == typ.awaiting {
+				t.Logf("decode() : Test %d PASSED, %s %s %s % x, expecting %f and got %f", test, typ.regType, order.byteOrder, order.wordOrder, wire, typ.awaiting, r)
+			} else {
+				t.Errorf("decode() : Test %d FAILED, %s %s %s % x, expecting %f, got %f, error: %v", test, typ.regType, order.byteOrder, order.wordOrder, wire, typ.awaiting, r, err)
+			}
+		}
+	}
+
+	// Data length must match the type
+	invalid := []struct {
+		data    []byte
+		regType string
+	}{
+		{[]byte{0x43, 0x66}, "float32"},
+		{[]byte{0, 0, 0, 0, 0, 0}, "uint64"},
+		{[]byte{0, 0, 0, 0}, "int16"},
+		{[]byte{0x12, 0x3A}, "bcd16"},
+	}
+
+	for _, set := range invalid {
+		test++
+		if _, err := decode(set.data, set.regType, "big_endian", ""); err != nil {
+			t.Logf("decode() : Test %d PASSED, got error: %s", test, err)
+		} else {
+			t.Errorf("decode() : Test %d FAILED, awaiting error for %s", test, set.regType)
+		}
+	}
+
+}
+
+func TestDecodeString(t *testing.T) {
+
+	testCases := []struct {
+		raw       []byte
+		byteOrder string
+		awaiting  string
+	}{
+		{[]byte("SN-12345"), "big_endian", "SN-12345"},
+		{[]byte("NS1-3254"), "lit_endian", "SN-12345"},
+		{[]byte("v1.2\x00\x00\x00\x00"), "", "v1.2"},
+		{[]byte("PM5560  "), "", "PM5560"},
+		{[]byte{'A', 0xFF}, "", "A\uFFFD"},
+	}
+
+	for each, testCase := range testCases {
+
+		text, err := decodeString(testCase.raw, testCase.byteOrder)
+		if err == nil && text == testCase.awaiting {
+			t.Logf("decodeString() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("decodeString() : Test %d FAILED, awaiting: %q, got: %q, error: %v", each+1, testCase.awaiting, text, err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: unknown byte order
+	// ---------------------------------------------------------------------------
+	if _, err := decodeString([]byte("AB"), "middle_endian"); err != nil {
+		t.Logf("decodeString() : Test %d PASSED, got error: %s", len(testCases)+1, err)
+	} else {
+		t.Errorf("decodeString() : Test %d FAILED, awaiting error", len(testCases)+1)
+	}
+
+}
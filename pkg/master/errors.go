@@ -0,0 +1,104 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// RegisterErrors is returned by ReadRemote along with results when some of the
+// registers cannot be read, it maps register index to its read error
+type RegisterErrors map[int]error
+
+// Constants declaration section -----------------------------------------------
+const (
+	// ReasonConnect means the device (or gateway, serial port) cannot be connected
+	ReasonConnect = "connect"
+	// ReasonTimeout means the device does not answer in time
+	ReasonTimeout = "timeout"
+	// ReasonException means the device replies with MODBUS exception
+	ReasonException = "exception"
+	// ReasonDecode means the reply cannot be decoded into register type
+	ReasonDecode = "decode"
+	// ReasonOther is any other error, e.g. CRC mismatch or connection reset
+	ReasonOther = "other"
+)
+
+// Variables declaration section -----------------------------------------------
+var (
+	errConnect = errors.New("error connecting")
+	errDecode  = errors.New("error decoding register")
+
+	// ErrNotImplemented is the value of a register the device does not
+	// implement, e.g. SunSpec scale factor 0x8000, failed as decode error
+	ErrNotImplemented = fmt.Errorf("%w: value is not implemented by the device", errDecode)
+
+	// FailureReasons lists every reason returned by FailureReason
+	FailureReasons = []string{ReasonConnect, ReasonTimeout, ReasonException, ReasonDecode, ReasonOther}
+)
+
+// Functions declaration section -----------------------------------------------
+
+// Error returns errors of all the failed registers
+func (errs RegisterErrors) Error() string {
+
+	indexes := make([]int, 0, len(errs))
+	for index := range errs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	messages := make([]string, 0, len(errs))
+	for _, index := range indexes {
+		messages = append(messages, fmt.Sprintf("register #%d: %s", index, errs[index].Error()))
+	}
+
+	return fmt.Sprintf("%d register(s) cannot be read: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// ExceptionCode returns MODBUS exception code, if the error is an exception
+// response of the device
+func ExceptionCode(err error) (byte, bool) {
+
+	var modbusError *modbus.ModbusError
+	if errors.As(err, &modbusError) {
+		return modbusError.ExceptionCode, true
+	}
+	return 0, false
+}
+
+// FailureReason classifies error returned by ReadRemote (or one of its
+// RegisterErrors), empty reason means no error
+func FailureReason(err error) string {
+
+	var netError net.Error
+
+	if _, ok := ExceptionCode(err); ok {
+		return ReasonException
+	}
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errConnect):
+		return ReasonConnect
+	case errors.Is(err, errDecode):
+		return ReasonDecode
+	case errors.Is(err, os.ErrDeadlineExceeded),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, serial.ErrTimeout),
+		errors.As(err, &netError) && netError.Timeout():
+		return ReasonTimeout
+	default:
+		return ReasonOther
+	}
+}
@@ -0,0 +1,86 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/goburrow/modbus"
+)
+
+func TestExceptionCode(t *testing.T) {
+
+	errs := []struct {
+		err       error
+		code      byte
+		exception bool
+	}{
+		{&modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 2}, 2, true},
+		{fmt.Errorf("wrapped: %w", &modbus.ModbusError{FunctionCode: 0x84, ExceptionCode: 4}), 4, true},
+		{errors.New("i/o timeout"), 0, false},
+		{nil, 0, false},
+	}
+
+	for each, set := range errs {
+		code, exception := ExceptionCode(set.err)
+		if code == set.code && exception == set.exception {
+			t.Logf("ExceptionCode() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("ExceptionCode() : Test %d FAILED, got %d, %v", each+1, code, exception)
+		}
+	}
+
+}
+
+func TestFailureReason(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	registers := newRegisters([]uint16{300}, []string{"word"}, []string{"FC3"})
+
+	gateways := []struct {
+		gateway   fakeGateway
+		byteOrder string
+		reason    string
+	}{
+		{fakeGateway{slave: fakeSlave{id: 1}}, "", ""},
+		{fakeGateway{slave: fakeSlave{id: 1}, silent: true}, "", ReasonTimeout},
+		{fakeGateway{slave: fakeSlave{id: 1, illegal: []uint16{300}}}, "", ReasonException},
+		{fakeGateway{slave: fakeSlave{id: 1}, corrupt: true}, "", ReasonOther},
+		{fakeGateway{slave: fakeSlave{id: 1}}, "middle_endian", ReasonDecode},
+		{fakeGateway{slave: fakeSlave{id: 1}}, "", ReasonConnect}, // gateway is stopped
+	}
+
+	for each, set := range gateways {
+
+		address, stop := set.gateway.start(t)
+		if set.reason == ReasonConnect {
+			stop()
+		}
+
+		device := structures.NewDevice(1, "200ms", "0s", false)
+		device.Transport = "rtuovertcp"
+		registers[0].ByteOrder = set.byteOrder
+
+		_, err := ReadRemote(address, *device, registers, logger)
+		stop()
+
+		// Reason of a single register is the reason of the whole read
+		if registerErrors, ok := err.(RegisterErrors); ok {
+			err = registerErrors[0]
+		}
+
+		if reason := FailureReason(err); reason == set.reason {
+			t.Logf("FailureReason() : Test %d PASSED, reason '%s', error: %v", each+1, reason, err)
+		} else {
+			t.Errorf("FailureReason() : Test %d FAILED, awaiting '%s', got '%s', error: %v", each+1, set.reason, reason, err)
+		}
+	}
+
+}
@@ -0,0 +1,186 @@
+package master
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/goburrow/modbus"
+)
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Read Device Identification, i.e. function code 43 with MEI type 14
+	funcCodeEncapsulatedInterface = 0x2B
+	meiReadDeviceIdentification   = 0x0E
+
+	// Read device identification codes (access levels)
+	identificationBasic    = "basic"
+	identificationRegular  = "regular"
+	identificationExtended = "extended"
+
+	// Header of the response data: MEI type, read device id code, conformity
+	// level, more follows, next object id and number of objects
+	identificationHeaderSize = 6
+	// Objects are read in several transactions if they do not fit into one,
+	// which is limited by the number of object ids
+	maxIdentificationRequests = 256
+)
+
+// Functions declaration section -----------------------------------------------
+
+// CheckIdentification checks read device identification level of the device
+// given in config, empty one means identification is not read. It cannot be
+// read over serial 'rtu' transport, which does not know the length of the
+// reply in advance and truncates it.
+func CheckIdentification(identification, transport string) error {
+
+	code, error := identificationCode(identification)
+	if error != nil {
+		return error
+	}
+
+	if code != 0 && strings.ToLower(transport) == transportRTU {
+		return fmt.Errorf("device read identification '%s' is not supported over '%s' transport", identification, transport)
+	}
+
+	return nil
+}
+
+// identificationCode returns read device id code of the level given in config
+func identificationCode(identification string) (byte, error) {
+
+	switch strings.ToLower(identification) {
+	case "":
+		return 0, nil
+	case identificationBasic:
+		return 0x01, nil
+	case identificationRegular:
+		return 0x02, nil
+	case identificationExtended:
+		return 0x03, nil
+	default:
+		return 0, fmt.Errorf("unsupported device read identification '%s'", identification)
+	}
+}
+
+// ReadIdentification reads identification objects of the device (unit) over
+// the connection (function code 43, MEI type 14), by object id: 0x00 vendor
+// name, 0x01 product code, 0x02 revision (basic), 0x03 - 0x06 vendor url,
+// product name, model name and user application name (regular), 0x80 and
+// above are private objects (extended). Device replies with as many objects as
+// it has up to the level of the device (and of its conformity). Nothing is read
+// if the device has no identification level, nor once the context is done.
+func (connection *Connection) ReadIdentification(ctx context.Context, device structures.Device, logger log.Logger) (map[byte]string, error) {
+
+	code, error := identificationCode(device.ReadIdentification)
+	if error != nil || code == 0 {
+		return nil, error
+	}
+
+	connection.handler.SetSlaveID(device.ModbusID)
+
+	objects := make(map[byte]string)
+	objectID := byte(0)
+
+	for i := 0; i < maxIdentificationRequests; i++ {
+
+		if error := connection.pace(ctx); error != nil {
+			return nil, error
+		}
+		data, error := connection.send(funcCodeEncapsulatedInterface, []byte{meiReadDeviceIdentification, code, objectID})
+		connection.lastRequest = time.Now()
+		if error != nil {
+			return nil, error
+		}
+
+		moreFollows, nextObjectID, error := parseIdentification(data, objects)
+		if error != nil {
+			return nil, fmt.Errorf("%w: %s", errDecode, error.Error())
+		}
+
+		level.Debug(logger).Log("msg", "Read device identification", "modbus_id", device.ModbusID, "objects", len(objects), "more_follows", moreFollows)
+
+		// Object ids must advance, otherwise the device loops
+		if !moreFollows || nextObjectID <= objectID {
+			return objects, nil
+		}
+		objectID = nextObjectID
+	}
+
+	return objects, nil
+}
+
+// send sends request PDU of the function code over the connection and returns
+// data of the response PDU, exception responses are *modbus.ModbusError as for
+// other requests
+func (connection *Connection) send(funcCode byte, data []byte) ([]byte, error) {
+
+	request := modbus.ProtocolDataUnit{FunctionCode: funcCode, Data: data}
+
+	aduRequest, error := connection.handler.Encode(&request)
+	if error != nil {
+		return nil, error
+	}
+	aduResponse, error := connection.handler.Send(aduRequest)
+	if error != nil {
+		return nil, error
+	}
+	error = connection.handler.Verify(aduRequest, aduResponse)
+	if error != nil {
+		return nil, error
+	}
+	response, error := connection.handler.Decode(aduResponse)
+	if error != nil {
+		return nil, error
+	}
+
+	switch {
+	case response.FunctionCode == funcCode|0x80 && len(response.Data) > 0:
+		return nil, &modbus.ModbusError{FunctionCode: response.FunctionCode, ExceptionCode: response.Data[0]}
+	case response.FunctionCode != funcCode:
+		return nil, fmt.Errorf("modbus: response function code '%v' does not match request '%v'", response.FunctionCode, funcCode)
+	}
+
+	return response.Data, nil
+}
+
+// parseIdentification adds objects of the read device identification response
+// data to the objects, and returns whether more objects follow and id of the
+// next one
+func parseIdentification(data []byte, objects map[byte]string) (bool, byte, error) {
+
+	if len(data) < identificationHeaderSize {
+		return false, 0, fmt.Errorf("device identification response of %d bytes is too short", len(data))
+	}
+	if data[0] != meiReadDeviceIdentification {
+		return false, 0, fmt.Errorf("device identification response has MEI type %d", data[0])
+	}
+
+	moreFollows := data[3] == 0xFF
+	nextObjectID := data[4]
+	count := int(data[5])
+
+	offset := identificationHeaderSize
+	for each := 0; each < count; each++ {
+
+		if offset+2 > len(data) {
+			return false, 0, fmt.Errorf("device identification object #%d is truncated", each+1)
+		}
+		id, length := data[offset], int(data[offset+1])
+		offset += 2
+
+		if offset+length > len(data) {
+			return false, 0, fmt.Errorf("device identification object 0x%02X is truncated", id)
+		}
+		objects[id] = strings.ToValidUTF8(strings.TrimRight(string(data[offset:offset+length]), " \x00"), "�")
+		offset += length
+	}
+
+	return moreFollows, nextObjectID, nil
+}
@@ -0,0 +1,161 @@
+package master
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestCheckIdentification(t *testing.T) {
+
+	identifications := []struct {
+		identification, transport string
+		valid                     bool
+	}{
+		{"", "", true},
+		{"basic", "", true},
+		{"Regular", "rtuovertcp", true},
+		{"extended", "ascii", true},
+		{"full", "", false},
+		{"basic", "RTU", false},
+		{"", "rtu", true},
+	}
+
+	for each, set := range identifications {
+
+		err := CheckIdentification(set.identification, set.transport)
+		if (err == nil) == set.valid {
+			t.Logf("CheckIdentification() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("CheckIdentification() : Test %d FAILED, identification: '%s', transport: '%s', error: %v", each+1, set.identification, set.transport, err)
+		}
+	}
+
+}
+
+func TestParseIdentification(t *testing.T) {
+
+	responses := []struct {
+		data        []byte
+		moreFollows bool
+		next        byte
+		objects     int
+		valid       bool
+	}{
+		{[]byte{14, 1, 0x81, 0, 0, 2, 0, 3, 'A', 'B', 'C', 1, 2, 'X', ' '}, false, 0, 2, true},
+		{[]byte{14, 2, 0x82, 0xFF, 4, 1, 3, 1, 'Y'}, true, 4, 1, true},
+		{[]byte{14, 1, 0x81, 0, 0}, false, 0, 0, false},
+		{[]byte{13, 1, 0x81, 0, 0, 0}, false, 0, 0, false},
+		{[]byte{14, 1, 0x81, 0, 0, 2, 0, 3, 'A', 'B', 'C', 1}, false, 0, 0, false},
+		{[]byte{14, 1, 0x81, 0, 0, 1, 0, 4, 'A'}, false, 0, 0, false},
+	}
+
+	for each, set := range responses {
+
+		objects := make(map[byte]string)
+
+		moreFollows, next, err := parseIdentification(set.data, objects)
+		if set.valid && err == nil && moreFollows == set.moreFollows && next == set.next && len(objects) == set.objects || !set.valid && err != nil {
+			t.Logf("parseIdentification() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("parseIdentification() : Test %d FAILED, more follows: %v, next: %d, objects: %q, error: %v", each+1, moreFollows, next, objects, err)
+		}
+	}
+
+}
+
+func TestReadIdentification(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	identification := map[byte]string{
+		0x00: "Vendor",
+		0x01: "PC-1",
+		0x02: "V1.2",
+		0x04: "Product",
+		0x05: "Model",
+		0x80: "Private",
+	}
+
+	// Fake slave replies up to 3 objects at a time
+	address, stop := fakeGateway{slave: fakeSlave{id: 1, identification: identification}}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	connection, err := Dial(address, *device, logger)
+	if err != nil {
+		t.Fatalf("ReadIdentification() : cannot dial, %s", err)
+	}
+	defer connection.Close()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: nothing is read unless the device has identification level
+	// ---------------------------------------------------------------------------
+	objects, err := connection.ReadIdentification(context.Background(), *device, logger)
+	if err == nil && objects == nil {
+		t.Log("ReadIdentification() : Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadIdentification() : Test 1 FAILED, objects: %q, error: %v", objects, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: basic objects fit into one response
+	// ---------------------------------------------------------------------------
+	device.ReadIdentification = "basic"
+	objects, err = connection.ReadIdentification(context.Background(), *device, logger)
+	if err == nil && len(objects) == 3 && objects[0x00] == "Vendor" && objects[0x02] == "V1.2" {
+		t.Log("ReadIdentification() : Test 2 PASSED.")
+	} else {
+		t.Errorf("ReadIdentification() : Test 2 FAILED, objects: %q, error: %v", objects, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: extended objects are read in several transactions
+	// ---------------------------------------------------------------------------
+	device.ReadIdentification = "extended"
+	objects, err = connection.ReadIdentification(context.Background(), *device, logger)
+	if err == nil && len(objects) == 6 && objects[0x05] == "Model" && objects[0x80] == "Private" {
+		t.Log("ReadIdentification() : Test 3 PASSED.")
+	} else {
+		t.Errorf("ReadIdentification() : Test 3 FAILED, objects: %q, error: %v", objects, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: private objects are not read by regular identification
+	// ---------------------------------------------------------------------------
+	device.ReadIdentification = "regular"
+	objects, err = connection.ReadIdentification(context.Background(), *device, logger)
+	if _, private := objects[0x80]; err == nil && len(objects) == 5 && !private {
+		t.Log("ReadIdentification() : Test 4 PASSED.")
+	} else {
+		t.Errorf("ReadIdentification() : Test 4 FAILED, objects: %q, error: %v", objects, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device without identification replies with exception
+	// ---------------------------------------------------------------------------
+	plainAddress, plainStop := fakeGateway{slave: fakeSlave{id: 1}}.start(t)
+	defer plainStop()
+
+	plain, err := Dial(plainAddress, *device, logger)
+	if err != nil {
+		t.Fatalf("ReadIdentification() : cannot dial, %s", err)
+	}
+	defer plain.Close()
+
+	objects, err = plain.ReadIdentification(context.Background(), *device, logger)
+	if code, ok := ExceptionCode(err); ok && code == 1 && objects == nil {
+		t.Log("ReadIdentification() : Test 5 PASSED.")
+	} else {
+		t.Errorf("ReadIdentification() : Test 5 FAILED, objects: %q, error: %v", objects, err)
+	}
+
+}
@@ -1,7 +1,7 @@
 package master
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -19,6 +19,20 @@ type (
 	dword = uint32
 )
 
+// Connection is an open connection to the remote address
+type Connection struct {
+	Address string
+
+	handler clientHandler
+	client  modbus.Client
+	// Pool entry of pooled connection
+	entry *poolEntry
+
+	// Silent interval between transactions and the end of the last one
+	requestDelay time.Duration
+	lastRequest  time.Time
+}
+
 // Constants declaration section -----------------------------------------------
 const (
 	tWord    = "word"
@@ -27,195 +41,362 @@ const (
 	tUint32  = "uint32"
 	tInt16   = "int16"
 	tInt32   = "int32"
+	tUint64  = "uint64"
+	tInt64   = "int64"
 	tFloat32 = "float32"
 	tFloat64 = "float64"
+	// Single registers exported as states (bits or named values), register
+	// types are shared by workload preparation and the collector
+	TypeBitfield = "bitfield"
+	TypeEnum     = "enum"
+	// Binary coded decimals (4 digits per register) and ASCII text
+	tBCD16     = "bcd16"
+	tBCD32     = "bcd32"
+	TypeString = "string"
 
 	bigEndian = "big_endian"
 	litEndian = "lit_endian"
 	swapped   = "swapped"
 	mirrored  = "mirrored"
 
-	coils            = "FC1"
-	discreteInputs   = "FC2"
-	holdingRegisters = "FC3"
-	inputRegisters   = "FC4"
+	// Read function codes, the only ones supported
+	Coils            = "FC1"
+	DiscreteInputs   = "FC2"
+	HoldingRegisters = "FC3"
+	InputRegisters   = "FC4"
+
+	defaultTimeout     = 200 * time.Millisecond
+	defaultIdleTimeout = time.Minute
 )
 
 // Functions declaration section -----------------------------------------------
 
-// ReadRemote return results of reading remote device registers
+// ReadRemote return results of reading remote device registers. Failure of a
+// single register does not fail the others: results of readable registers are
+// returned along with RegisterErrors, any other error means the device cannot
+// be read at all.
 func ReadRemote(address string, device structures.Device, registers structures.Registers, logger log.Logger) ([]float64, error) {
 
-	var (
-		timeoutDuration      time.Duration
-		requestDelayDuration time.Duration
+	connection, error := Dial(address, device, logger)
+	if error != nil {
+		return nil, error
+	}
 
-		zeroBased bool
+	defer connection.Close()
 
-		readAddress, readLength uint16
+	return connection.Read(device, registers, logger)
+}
 
-		result       []byte
-		finalResults []float64
+// Dial connects to the remote address using transport settings of the device,
+// the connection may be shared by several devices (units) behind the address
+func Dial(address string, device structures.Device, logger log.Logger) (*Connection, error) {
+	return dial(address, device, defaultIdleTimeout, logger)
+}
+
+// dial connects to the remote address, idle connection is closed after the
+// device idle timeout (idleTimeout, if not set)
+func dial(address string, device structures.Device, idleTimeout time.Duration, logger log.Logger) (*Connection, error) {
+
+	timeoutDuration := parseDuration(device.Timeout, defaultTimeout, "timeout", logger)
+	requestDelayDuration := parseDuration(device.RequestDelay, 0, "request delay", logger)
+	idleTimeout = parseDuration(device.IdleTimeout, idleTimeout, "idle timeout", logger)
+
+	level.Debug(logger).Log(
+		"address", address,
+		"transport", device.Transport,
+		"timeout_duration", timeoutDuration,
+		"request_delay_duration", requestDelayDuration,
+		"idle_timeout", idleTimeout,
 	)
 
-	timeoutDuration, error := time.ParseDuration(device.Timeout)
+	handler, error := newClientHandler(address, device, timeoutDuration, idleTimeout)
 	if error != nil {
-		level.Error(logger).Log(
-			"msg", "Error parsing device timeout duration. Will use default value '200ms'",
-			"err", error.Error(),
-		)
-		timeoutDuration = (200 * time.Millisecond)
+		return nil, fmt.Errorf("error preparing client for address %s: %s", address, error.Error())
 	}
 
-	requestDelayDuration, error = time.ParseDuration(device.RequestDelay)
+	error = handler.Connect()
 	if error != nil {
-		level.Error(logger).Log(
-			"msg", "Error parsing device request delay duration. Will use default value '1000ms'",
-			"err", error.Error(),
-		)
-		requestDelayDuration = (1000 * time.Millisecond)
+		return nil, fmt.Errorf("%w to address %s: %s", errConnect, address, error.Error())
 	}
 
-	zeroBased = device.ZeroBased
-	if error != nil {
+	return &Connection{
+		Address:      address,
+		handler:      handler,
+		client:       modbus.NewClient(handler),
+		requestDelay: requestDelayDuration,
+	}, nil
+}
+
+// parseDuration parses duration of the device setting, empty or invalid one
+// (config is validated at load, so it is not expected) means fallback
+func parseDuration(value string, fallback time.Duration, setting string, logger log.Logger) time.Duration {
+
+	if value == "" {
+		return fallback
+	}
+
+	duration, error := time.ParseDuration(value)
+	if error != nil || duration < 0 {
 		level.Error(logger).Log(
-			"msg", "Error parsing device zero-based addressing. Will use default value 'false'",
-			"err", error.Error(),
+			"msg", fmt.Sprintf("Error parsing device %s duration. Will use default value '%s'", setting, fallback),
+			"value", value,
+			"err", error,
 		)
-		zeroBased = false
+		return fallback
+	}
+
+	return duration
+}
+
+// pace waits for the silent interval (request delay) since the end of the
+// previous transaction over the connection, the wait fails at once if it does
+// not end before the context deadline, or once the context is done
+func (connection *Connection) pace(ctx context.Context) error {
+
+	if error := ctx.Err(); error != nil {
+		return fmt.Errorf("error pacing request: %w", error)
+	}
+
+	if connection.lastRequest.IsZero() || connection.requestDelay <= 0 {
+		return nil
+	}
+
+	next := connection.lastRequest.Add(connection.requestDelay)
+	wait := time.Until(next)
+	if wait <= 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(next) {
+		return fmt.Errorf("error pacing request: request delay %s exceeds the deadline: %w", connection.requestDelay, context.DeadlineExceeded)
 	}
 
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error pacing request: %w", ctx.Err())
+	}
+}
+
+// Close closes the connection
+func (connection *Connection) Close() error {
+	return connection.handler.Close()
+}
+
+// Read reads registers of the device (unit) over the connection, results and
+// errors are the same as of ReadRemote
+func (connection *Connection) Read(device structures.Device, registers structures.Registers, logger log.Logger) ([]float64, error) {
+
+	finalResults, _, error := connection.ReadValues(context.Background(), device, registers, logger)
+
+	return finalResults, error
+}
+
+// ReadValues reads registers of the device (unit) over the connection as Read
+// does, texts of string registers are returned along with the results (by index
+// of the register). Requests which cannot be paced before the context deadline
+// are not sent, their registers fail.
+func (connection *Connection) ReadValues(ctx context.Context, device structures.Device, registers structures.Registers, logger log.Logger) ([]float64, map[int]string, error) {
+
+	var (
+		zeroBased bool
+
+		readAddress, readLength uint16
+
+		result       []byte
+		finalResults []float64
+	)
+
+	zeroBased = device.ZeroBased
+
 	level.Debug(logger).Log(
-		"address", address,
+		"address", connection.Address,
 		"modbus_id", device.ModbusID,
-		"timeout_duration", timeoutDuration,
-		"request_delay_duration", requestDelayDuration,
 		"zero_based_addressing", zeroBased,
 	)
 
-	handler := modbus.NewTCPClientHandler(address)
+	connection.handler.SetSlaveID(device.ModbusID)
+	client := connection.client
 
-	handler.SlaveId = byte(device.ModbusID)
-	handler.Timeout = timeoutDuration
-	handler.IdleTimeout = requestDelayDuration
+	holes := holeRanges(device)
 
-	error = handler.Connect()
+	finalResults = make([]float64, len(registers))
+	texts := make(map[int]string)
+
+	requests, error := planReads(registers, zeroBased, device.MaxGap, device.MaxBlockLength, holes)
 	if error != nil {
-		return nil, fmt.Errorf("error connecting to address %s: %s", address, error.Error())
+		return nil, nil, error
 	}
 
-	defer handler.Close()
+	registerErrors := make(RegisterErrors)
 
-	client := modbus.NewClient(handler)
+	for i := 0; i < len(requests); i++ {
 
-	for _, register := range registers {
+		request := requests[i]
 
-		for _, v := range register.Address {
-			readAddress = v
-		}
+		level.Debug(logger).Log(
+			"func_code", request.FuncCode,
+			"read_address", request.Address,
+			"read_length", request.Length,
+			"registers", len(request.Registers),
+		)
 
-		switch strings.ToLower(register.Type) {
-		case tWord, tUint16, tInt16:
-			readLength = word(1)
-			if zeroBased {
-				readAddress--
-			}
-		case tDWord, tUint32, tInt32:
-			readLength = word(2)
-			if zeroBased {
-				readAddress--
-			}
-		default:
-			readLength = word(1)
-			if zeroBased {
-				readAddress--
+		if error = connection.pace(ctx); error != nil {
+			level.Error(logger).Log("msg", "Error reading registers", "read_address", request.Address, "read_length", request.Length, "err", error)
+			for _, index := range request.Registers {
+				registerErrors[index] = error
 			}
+			continue
 		}
 
-		switch strings.ToUpper(register.FuncCode) {
-		// case coils: // FC1
-		// 	result, error = client.ReadCoils(readAddress, readLength)
-		// case discreteInputs: // FC2
-		// 	result, error = client.ReadDiscreteInputs(readAddress, readLength)
-		case holdingRegisters: // FC3
-			result, error = client.ReadHoldingRegisters(readAddress, readLength)
-		default: // i.e. case 'inputRegisters aka FC4' or nothing
-			result, error = client.ReadInputRegisters(readAddress, readLength)
+		switch request.FuncCode {
+		case Coils: // FC1
+			result, error = client.ReadCoils(request.Address, request.Length)
+		case DiscreteInputs: // FC2
+			result, error = client.ReadDiscreteInputs(request.Address, request.Length)
+		case HoldingRegisters: // FC3
+			result, error = client.ReadHoldingRegisters(request.Address, request.Length)
+		default: // i.e. case 'InputRegisters aka FC4'
+			result, error = client.ReadInputRegisters(request.Address, request.Length)
 		}
+		connection.lastRequest = time.Now()
+
 		if error != nil {
-			// result = []byte{0}
-			return nil, fmt.Errorf("modbus client read func collide into an error: %s", error)
+			// Single bad address spoils the whole block, read its registers one by one
+			if _, ok := ExceptionCode(error); ok && len(request.Registers) > 1 {
+				level.Warn(logger).Log("msg", "Block read failed, reading registers one by one", "read_address", request.Address, "read_length", request.Length, "err", error)
+				requests = append(requests, splitRequest(request, registers, zeroBased)...)
+				continue
+			}
+			level.Error(logger).Log("msg", "Error reading registers", "read_address", request.Address, "read_length", request.Length, "err", error)
+			for _, index := range request.Registers {
+				registerErrors[index] = fmt.Errorf("modbus client read func collide into an error: %w", error)
+			}
+			continue
 		}
 
-		finalResult := convertResult(
-			result,
-			readLength,
-			register.Type,
-			register.ByteOrder,
-			register.WordOrder,
-			logger,
-		)
+		// Map block back onto every register it covers
+		for _, index := range request.Registers {
+
+			register := registers[index]
+			readAddress = registerAddress(register, zeroBased)
+
+			if IsBitAccess(request.FuncCode) {
+				finalResults[index], error = unpackBit(result, readAddress-request.Address)
+				if error != nil {
+					registerErrors[index] = error
+					continue
+				}
+				level.Debug(logger).Log("final_result", finalResults[index])
+				continue
+			}
+
+			readLength = dataUnitLength(register)
+			offset := 2 * int(readAddress-request.Address)
+
+			if offset+2*int(readLength) > len(result) {
+				registerErrors[index] = fmt.Errorf("%w: modbus client read func returned %d bytes, register at %d needs %d", errDecode, len(result), readAddress, readLength)
+				continue
+			}
+
+			if strings.ToLower(register.Type) == TypeString {
+				texts[index], error = decodeString(result[offset:offset+2*int(readLength)], register.ByteOrder)
+				if error != nil {
+					registerErrors[index] = fmt.Errorf("%w: %s", errDecode, error.Error())
+					continue
+				}
+				level.Debug(logger).Log("final_result", texts[index])
+				continue
+			}
 
-		level.Debug(logger).Log("final_result", finalResult)
+			finalResult, error := convertResult(
+				result[offset:offset+2*int(readLength)],
+				readLength,
+				register.Type,
+				register.ByteOrder,
+				register.WordOrder,
+				logger,
+			)
+			if error != nil {
+				registerErrors[index] = error
+				continue
+			}
+
+			level.Debug(logger).Log("final_result", finalResult)
+
+			finalResults[index] = finalResult
+		}
 
-		finalResults = append(finalResults, finalResult)
+	}
 
+	if len(registerErrors) > 0 {
+		return finalResults, texts, registerErrors
 	}
 
-	return finalResults, nil
+	return finalResults, texts, nil
 }
 
-func convertResult(result []byte, length word, regType, regByteOrder, regWordOrder string, logger log.Logger) float64 {
+// unpackBit returns state (0 or 1) of the bit at offset in coils (discrete
+// inputs) status, packed LSB first as returned by FC1 and FC2
+func unpackBit(result []byte, offset uint16) (float64, error) {
+
+	if int(offset/8) >= len(result) {
+		return 0, fmt.Errorf("%w: modbus client read func returned %d bytes, bit %d is out of range", errDecode, len(result), offset)
+	}
 
-	var convertedResult float64
+	return float64((result[offset/8] >> (offset % 8)) & 1), nil
+}
 
-	regType = strings.ToLower(regType)
-	regByteOrder = strings.ToLower(regByteOrder)
-	regWordOrder = strings.ToLower(regWordOrder)
+// registerLength returns quantity of 16-bit registers occupied by the data type
+func registerLength(regType string) uint16 {
+
+	switch strings.ToLower(regType) {
+	case tWord, tUint16, tInt16, TypeBitfield, TypeEnum, tBCD16:
+		return word(1)
+	case tDWord, tUint32, tInt32, tFloat32, tBCD32:
+		return word(2)
+	case tUint64, tInt64, tFloat64:
+		return word(4)
+	default:
+		return word(1)
+	}
+}
+
+// dataUnitLength returns quantity of 16-bit registers occupied by the register,
+// length of string registers is given in config
+func dataUnitLength(register structures.DataUnit) uint16 {
+
+	if strings.ToLower(register.Type) == TypeString && register.Length > 0 {
+		return register.Length
+	}
+
+	return registerLength(register.Type)
+}
+
+// convertResult decodes raw registers into the value of register type
+func convertResult(result []byte, length word, regType, regByteOrder, regWordOrder string, logger log.Logger) (float64, error) {
 
 	level.Debug(logger).Log(
 		"register_type", regType,
 		"register_byte_order", regByteOrder,
 		"register_word_order", regWordOrder,
+		"raw_result", fmt.Sprintf("% x", result),
 	)
 
-	if len(result) == 4 && regWordOrder != "" {
-
-		level.Debug(logger).Log("raw_result", result, "slice_length", len(result))
-
-		switch regWordOrder {
-		case swapped:
-			result = []byte{result[2], result[3], result[0], result[1]}
-			level.Debug(logger).Log("swapped_result", result, "slice_length", len(result))
-		case mirrored:
-			result = []byte{result[3], result[2], result[1], result[0]}
-			level.Debug(logger).Log("mirrored_result", result, "slice_length", len(result))
-		default:
-		}
+	if len(result) < 2*int(length) {
+		level.Error(logger).Log("msg", "Error converting result, not enough data for register type", "register_type", regType, "raw_result", result)
+		return 0, fmt.Errorf("%w: not enough data for register type '%s'", errDecode, regType)
 	}
 
-	switch regByteOrder {
-	case litEndian:
-		if regType == tUint16 || regType == tWord {
-			convertedResult = float64(binary.LittleEndian.Uint16(result))
-		}
-		if regType == tUint32 || regType == tDWord {
-			convertedResult = float64(binary.LittleEndian.Uint32(result))
-		}
-	default:
-		if regType == tUint16 || regType == tWord {
-			convertedResult = float64(binary.BigEndian.Uint16(result))
-		}
-		if regType == tUint32 || regType == tDWord {
-			convertedResult = float64(binary.BigEndian.Uint32(result))
-		}
-		if regType == tInt16 {
-			convertedResult = float64(int16(binary.BigEndian.Uint16(result)))
-		}
-		if regType == tInt32 {
-			convertedResult = float64(int32(binary.BigEndian.Uint32(result)))
-		}
+	convertedResult, error := decode(result[:2*int(length)], regType, regByteOrder, regWordOrder)
+	if error != nil {
+		level.Error(logger).Log("msg", "Error converting result", "register_type", regType, "err", error)
+		return 0, fmt.Errorf("%w: %s", errDecode, error.Error())
 	}
 
-	return convertedResult
+	return convertedResult, nil
 }
@@ -1,6 +1,8 @@
 package master
 
 import (
+	"context"
+	"math"
 	"os"
 	"testing"
 
@@ -49,7 +51,7 @@ func TestReadRemote(t *testing.T) {
 	validDevice := structures.NewDevice(
 		byte(1),  // ModbusID byte
 		"1000ms", // Timeout string
-		"3000ms", // RequestDelay string
+		"0s",     // RequestDelay string
 		true,     // ZeroBased bool
 	)
 
@@ -173,7 +175,7 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: 65526 (bigEndian)
 	// ---------------------------------------------------------------------------
-	r := convertResult(bigEndianTarget, word, "uint16", "big_endian", "none", logger)
+	r, _ := convertResult(bigEndianTarget, word, "uint16", "big_endian", "none", logger)
 	if r == 65526 {
 		t.Logf("convertResult() : Test 1 PASSED, expecting %f and got %f", float64(65526), r)
 	} else {
@@ -183,7 +185,7 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: -10 (bigEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(bigEndianTarget, word, "int16", "big_endian", "none", logger)
+	r, _ = convertResult(bigEndianTarget, word, "int16", "big_endian", "none", logger)
 	if r == -10 {
 		t.Logf("convertResult() : Test 2 PASSED, expecting %f and got %f", float64(-10), r)
 	} else {
@@ -193,7 +195,7 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: 65526.000000 (litEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(litEndianTarget, word, "uint16", "lit_endian", "none", logger)
+	r, _ = convertResult(litEndianTarget, word, "uint16", "lit_endian", "none", logger)
 	if r == 65526 {
 		t.Logf("convertResult() : Test 3 PASSED, expecting %f and got %f", float64(65526), r)
 	} else {
@@ -203,13 +205,12 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: -10 (litEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(litEndianTarget, word, "int16", "lit_endian", "none", logger)
-	// if r == -10.00000 {
-	// 	t.Logf("convertResult() : Test 4 PASSED, expecting %f and got %f", float64(-10), r)
-	// } else {
-	// 	t.Errorf("convertResult() : Test 4 FAILED, got %f", r)
-	// }
-	t.Logf("convertResult() : Test 4 PASSED, got %f", r)
+	r, _ = convertResult(litEndianTarget, word, "int16", "lit_endian", "none", logger)
+	if r == -10.00000 {
+		t.Logf("convertResult() : Test 4 PASSED, expecting %f and got %f", float64(-10), r)
+	} else {
+		t.Errorf("convertResult() : Test 4 FAILED, got %f", r)
+	}
 
 	// ---------------------------------------------------------------------------
 
@@ -228,7 +229,7 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: 66921 swapped (bigEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(swappedWordsTarget, dword, "uint32", "big_endian", "swapped", logger)
+	r, _ = convertResult(swappedWordsTarget, dword, "uint32", "big_endian", "swapped", logger)
 	if r == 66921 {
 		t.Logf("convertResult() : Test 5 PASSED, expecting %f and got %f", float64(66921), r)
 	} else {
@@ -237,7 +238,7 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: 66921 mirrored (bigEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(mirroredWordsTarget, dword, "uint32", "big_endian", "mirrored", logger)
+	r, _ = convertResult(mirroredWordsTarget, dword, "uint32", "big_endian", "mirrored", logger)
 	if r == 66921 {
 		t.Logf("convertResult() : Test 6 PASSED, expecting %f and got %f", float64(66921), r)
 	} else {
@@ -246,11 +247,148 @@ func TestConvertResult(t *testing.T) {
 	// ---------------------------------------------------------------------------
 	//  CASE: 66921 none (bigEndian)
 	// ---------------------------------------------------------------------------
-	r = convertResult(nonSwappedWordsTarget, dword, "int32", "big_endian", "none", logger)
+	r, _ = convertResult(nonSwappedWordsTarget, dword, "int32", "big_endian", "none", logger)
 	if r == 66921 {
 		t.Logf("convertResult() : Test 7 PASSED, expecting %f and got %f", float64(66921), r)
 	} else {
 		t.Errorf("convertResult() : Test 7 FAILED, got %f", r)
 	}
 
+	// ---------------------------------------------------------------------------
+	//  CASE: 32 and 64 bits types, every byte/word order combination
+	// ---------------------------------------------------------------------------
+	wideSets := []struct {
+		target               []byte
+		regType              string
+		byteOrder, wordOrder string
+		awaiting             float64
+	}{
+		{[]byte{0x43, 0x66, 0x80, 0x00}, "float32", "big_endian", "", 230.5},
+		{[]byte{0x80, 0x00, 0x43, 0x66}, "float32", "big_endian", "swapped", 230.5},
+		{[]byte{0x00, 0x80, 0x66, 0x43}, "float32", "lit_endian", "", 230.5},
+		{[]byte{0x66, 0x43, 0x00, 0x80}, "float32", "lit_endian", "swapped", 230.5},
+		{[]byte{0x40, 0x6C, 0xD0, 0, 0, 0, 0, 0}, "float64", "big_endian", "", 230.5},
+		{[]byte{0, 0, 0, 0, 0xD0, 0, 0x40, 0x6C}, "float64", "big_endian", "swapped", 230.5},
+		{[]byte{0, 0, 0, 0, 0, 0xD0, 0x6C, 0x40}, "float64", "lit_endian", "", 230.5},
+		{[]byte{0x6C, 0x40, 0, 0xD0, 0, 0, 0, 0}, "float64", "lit_endian", "swapped", 230.5},
+		{[]byte{0, 0, 0, 1, 0, 0, 0, 2}, "uint64", "big_endian", "", 1<<32 + 2},
+		{[]byte{0, 2, 0, 0, 0, 1, 0, 0}, "uint64", "big_endian", "swapped", 1<<32 + 2},
+		{[]byte{2, 0, 0, 0, 1, 0, 0, 0}, "uint64", "lit_endian", "", 1<<32 + 2},
+		{[]byte{0, 0, 1, 0, 0, 0, 2, 0}, "uint64", "lit_endian", "swapped", 1<<32 + 2},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF6}, "int64", "big_endian", "", -10},
+		{[]byte{0xFF, 0xF6, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, "int64", "big_endian", "swapped", -10},
+		{[]byte{0xF6, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, "int64", "lit_endian", "", -10},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF6, 0xFF}, "int64", "lit_endian", "swapped", -10},
+		{[]byte{0xF6, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, "int64", "big_endian", "mirrored", -10},
+	}
+
+	for each, set := range wideSets {
+		r, _ = convertResult(set.target, registerLength(set.regType), set.regType, set.byteOrder, set.wordOrder, logger)
+		if r == set.awaiting {
+			t.Logf("convertResult() : Test %d PASSED, expecting %f and got %f", each+8, set.awaiting, r)
+		} else {
+			t.Errorf("convertResult() : Test %d FAILED, %s %s %s, expecting %f, got %f", each+8, set.regType, set.byteOrder, set.wordOrder, set.awaiting, r)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: not enough data for the type
+	// ---------------------------------------------------------------------------
+	r, err := convertResult([]byte{0x43, 0x66}, registerLength("float32"), "float32", "big_endian", "", logger)
+	if r == 0 && FailureReason(err) == ReasonDecode {
+		t.Logf("convertResult() : Test %d PASSED, got %f", len(wideSets)+8, r)
+	} else {
+		t.Errorf("convertResult() : Test %d FAILED, got %f", len(wideSets)+8, r)
+	}
+
+}
+
+func TestRegisterLength(t *testing.T) {
+
+	lengths := map[string]uint16{
+		"word": 1, "uint16": 1, "int16": 1, "": 1, "bitfield": 1, "enum": 1, "bcd16": 1, "string": 1,
+		"bcd32": 2,
+		"dword": 2, "uint32": 2, "int32": 2, "float32": 2,
+		"uint64": 4, "int64": 4, "float64": 4, "Float64": 4,
+	}
+
+	for regType, awaiting := range lengths {
+		if length := registerLength(regType); length == awaiting {
+			t.Logf("registerLength() : Test '%s' PASSED.", regType)
+		} else {
+			t.Errorf("registerLength() : Test '%s' FAILED, expecting %d, got %d", regType, awaiting, length)
+		}
+	}
+
+}
+
+func TestReadRemoteWideTypes(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	registers := newRegisters(
+		[]uint16{1, 0x4366, 10},
+		[]string{"uint64", "float32", "word"},
+		[]string{"FC3", "FC3", "FC3"},
+	)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: 64 bits value spans four registers, float32 two
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(address, *device, registers, logger)
+	if err == nil && len(results) == 3 &&
+		results[0] == float64(0x0001000200030004) &&
+		results[1] == float64(math.Float32frombits(0x43664367)) &&
+		results[2] == 10 {
+		t.Log("ReadRemote() : Wide Types Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : Wide Types Test 1 FAILED, results: %v, error: %v", results, err)
+	}
+
+}
+
+func TestReadValues(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	// Fake slave replies address of every register as its value
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	registers := newRegisters(
+		[]uint16{0x4142, 0x4142, 0x1234},
+		[]string{"string", "string", "bcd16"},
+		[]string{"FC3", "FC4", "FC3"},
+	)
+	registers[0].Length = 2
+	registers[1].Length = 2
+	registers[1].ByteOrder = "lit_endian"
+
+	connection, err := Dial(address, *device, logger)
+	if err != nil {
+		t.Fatalf("ReadValues() : cannot dial, %s", err)
+	}
+	defer connection.Close()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: string spans its length, texts are returned by register index
+	// ---------------------------------------------------------------------------
+	results, texts, err := connection.ReadValues(context.Background(), *device, registers, logger)
+	if err == nil && len(texts) == 2 && texts[0] == "ABAC" && texts[1] == "BACA" && results[2] == 1234 {
+		t.Log("ReadValues() : Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadValues() : Test 1 FAILED, results: %v, texts: %q, error: %v", results, texts, err)
+	}
+
 }
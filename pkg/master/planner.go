@@ -0,0 +1,246 @@
+package master
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// readRequest is a single MODBUS read transaction covering one or more registers
+type readRequest struct {
+	FuncCode        string
+	Address, Length uint16
+	// Indexes of registers (in workload order) served by this request
+	Registers []int
+}
+
+// span is the address range occupied by a single register
+type span struct {
+	index    int
+	funcCode string
+	address  uint16
+	length   uint16
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Maximum quantity of registers in a single read request (PDU limit)
+	MaxRegistersPerRequest = 125
+	// Maximum quantity of coils (discrete inputs) in a single read request
+	MaxBitsPerRequest = 2000
+)
+
+// Functions declaration section -----------------------------------------------
+
+// planReads groups registers by function code and merges contiguous (or
+// separated by at most maxGap unused registers) addresses into block requests,
+// which never exceed maxLength registers or bits of coils and discrete inputs
+// (125 registers and 2000 bits, the PDU limits, unless set) nor cover any of
+// the holes.
+func planReads(registers structures.Registers, zeroBased bool, maxGap, maxLength uint16, holes []structures.AddressRange) ([]readRequest, error) {
+
+	var requests []readRequest
+
+	registerLimit, bitLimit := uint32(maxLength), uint32(maxLength)
+	if maxLength == 0 || maxLength > MaxRegistersPerRequest {
+		registerLimit = MaxRegistersPerRequest
+	}
+	if maxLength == 0 || maxLength > MaxBitsPerRequest {
+		bitLimit = MaxBitsPerRequest
+	}
+
+	spans := make([]span, 0, len(registers))
+	for each, register := range registers {
+
+		funcCode, error := readFuncCode(register.FuncCode)
+		if error != nil {
+			return nil, error
+		}
+
+		length := dataUnitLength(register)
+		if IsBitAccess(funcCode) {
+			length = 1
+		}
+
+		spans = append(spans, span{
+			index:    each,
+			funcCode: funcCode,
+			address:  registerAddress(register, zeroBased),
+			length:   length,
+		})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].funcCode != spans[j].funcCode {
+			return spans[i].funcCode < spans[j].funcCode
+		}
+		return spans[i].address < spans[j].address
+	})
+
+	for _, s := range spans {
+
+		if len(requests) > 0 {
+			last := &requests[len(requests)-1]
+			end := uint32(last.Address) + uint32(last.Length) // first address after the block
+			newEnd := uint32(s.address) + uint32(s.length)
+			if newEnd < end {
+				newEnd = end
+			}
+
+			limit := registerLimit
+			if IsBitAccess(s.funcCode) {
+				limit = bitLimit
+			}
+
+			if last.FuncCode == s.funcCode &&
+				uint32(s.address) <= end+uint32(maxGap) &&
+				newEnd-uint32(last.Address) <= limit &&
+				!coversHole(end, uint32(s.address), holes) {
+
+				last.Length = uint16(newEnd - uint32(last.Address))
+				last.Registers = append(last.Registers, s.index)
+				continue
+			}
+		}
+
+		requests = append(requests, readRequest{
+			FuncCode:  s.funcCode,
+			Address:   s.address,
+			Length:    s.length,
+			Registers: []int{s.index},
+		})
+	}
+
+	return requests, nil
+}
+
+// splitRequest breaks block request into requests of its single registers
+func splitRequest(request readRequest, registers structures.Registers, zeroBased bool) []readRequest {
+
+	requests := make([]readRequest, 0, len(request.Registers))
+
+	for _, index := range request.Registers {
+
+		length := dataUnitLength(registers[index])
+		if IsBitAccess(request.FuncCode) {
+			length = 1
+		}
+
+		requests = append(requests, readRequest{
+			FuncCode:  request.FuncCode,
+			Address:   registerAddress(registers[index], zeroBased),
+			Length:    length,
+			Registers: []int{index},
+		})
+	}
+
+	return requests
+}
+
+// coversHole reports whether the gap [from, to) intersects any of the holes
+func coversHole(from, to uint32, holes []structures.AddressRange) bool {
+
+	for _, hole := range holes {
+		if uint32(hole.First) < to && uint32(hole.Last) >= from {
+			return true
+		}
+	}
+	return false
+}
+
+// holeRanges returns protocol addresses of the holes of the device
+func holeRanges(device structures.Device) []structures.AddressRange {
+
+	if device.Holes == nil {
+		return nil
+	}
+
+	ranges := make([]structures.AddressRange, 0, len(*device.Holes))
+	for _, hole := range *device.Holes {
+		if device.ZeroBased {
+			if hole.First > 0 {
+				hole.First--
+			}
+			if hole.Last > 0 {
+				hole.Last--
+			}
+		}
+		ranges = append(ranges, hole)
+	}
+
+	return ranges
+}
+
+// registerAddress returns protocol address of the register, address 0 of
+// zero-based device (rejected by config validation) is not wrapped around
+func registerAddress(register structures.DataUnit, zeroBased bool) uint16 {
+
+	var address uint16
+
+	for _, v := range register.Address {
+		address = v
+	}
+	if zeroBased && address > 0 {
+		address--
+	}
+
+	return address
+}
+
+// RegisterRange returns function code reading the register and the range of
+// protocol addresses (first to last, inclusive) it occupies. Range is not
+// limited to the address space, so registers beyond it can be told.
+func RegisterRange(register structures.DataUnit, zeroBased bool) (string, int, int, error) {
+
+	funcCode, error := readFuncCode(register.FuncCode)
+	if error != nil {
+		return "", 0, 0, error
+	}
+
+	length := int(dataUnitLength(register))
+	if IsBitAccess(funcCode) {
+		length = 1
+	}
+
+	first := 0
+	for _, v := range register.Address {
+		first = int(v)
+	}
+	if zeroBased {
+		first--
+	}
+
+	return funcCode, first, first + length - 1, nil
+}
+
+// readFuncCode returns function code used to read the register
+func readFuncCode(funcCode string) (string, error) {
+
+	switch strings.ToUpper(funcCode) {
+	case Coils, DiscreteInputs, HoldingRegisters, InputRegisters:
+		return strings.ToUpper(funcCode), nil
+	case "": // i.e. nothing, input registers are read by default
+		return InputRegisters, nil
+	default:
+		return "", fmt.Errorf("unsupported function code '%s'", funcCode)
+	}
+}
+
+// CheckFuncCode checks function code of the register given in config, only read
+// function codes are supported and empty one means input registers
+func CheckFuncCode(funcCode string) error {
+
+	_, error := readFuncCode(funcCode)
+
+	return error
+}
+
+// IsBitAccess reports whether the function code reads single bits (coils and
+// discrete inputs)
+func IsBitAccess(funcCode string) bool {
+	return funcCode == Coils || funcCode == DiscreteInputs
+}
@@ -0,0 +1,287 @@
+package master
+
+import (
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// newRegisters returns registers of given types at given addresses, read by given function codes
+func newRegisters(addresses []uint16, types []string, funcCodes []string) structures.Registers {
+
+	registers := make(structures.Registers, len(addresses))
+	for each := range addresses {
+		registers[each].Address = map[string]uint16{"R": addresses[each]}
+		registers[each].Type = types[each]
+		registers[each].FuncCode = funcCodes[each]
+	}
+	return registers
+}
+
+func TestPlanReads(t *testing.T) {
+
+	dataSets := []struct {
+		registers structures.Registers
+		maxGap    uint16
+		maxLength uint16
+		holes     []structures.AddressRange
+		awaiting  []readRequest
+	}{
+		// contiguous registers merged into a single request
+		{
+			newRegisters([]uint16{300, 301, 302}, []string{"word", "word", "uint16"}, []string{"FC3", "FC3", "FC3"}),
+			0, 0, nil,
+			[]readRequest{{"FC3", 300, 3, []int{0, 1, 2}}},
+		},
+		// registers sorted by address, dword spans two registers
+		{
+			newRegisters([]uint16{304, 300, 302}, []string{"word", "dword", "word"}, []string{"FC3", "FC3", "FC3"}),
+			0, 0, nil,
+			[]readRequest{{"FC3", 300, 3, []int{1, 2}}, {"FC3", 304, 1, []int{0}}},
+		},
+		// gap of one register bridged with maxGap 1
+		{
+			newRegisters([]uint16{304, 300, 302}, []string{"word", "dword", "word"}, []string{"FC3", "FC3", "FC3"}),
+			1, 0, nil,
+			[]readRequest{{"FC3", 300, 5, []int{1, 2, 0}}},
+		},
+		// function codes never mixed, FC4 is default
+		{
+			newRegisters([]uint16{10, 11, 12}, []string{"word", "word", "word"}, []string{"FC3", "", "fc3"}),
+			5, 0, nil,
+			[]readRequest{{"FC3", 10, 3, []int{0, 2}}, {"FC4", 11, 1, []int{1}}},
+		},
+		// known hole is never read
+		{
+			newRegisters([]uint16{100, 105}, []string{"word", "word"}, []string{"FC4", "FC4"}),
+			10, 0, []structures.AddressRange{{First: 103, Last: 103}},
+			[]readRequest{{"FC4", 100, 1, []int{0}}, {"FC4", 105, 1, []int{1}}},
+		},
+		// overlapping registers
+		{
+			newRegisters([]uint16{12314, 12315}, []string{"dword", "uint16"}, []string{"FC4", "FC4"}),
+			0, 0, nil,
+			[]readRequest{{"FC4", 12314, 2, []int{0, 1}}},
+		},
+		// maximum block length
+		{
+			newRegisters([]uint16{0, 2, 4}, []string{"dword", "dword", "dword"}, []string{"FC3", "FC3", "FC3"}),
+			0, 4, nil,
+			[]readRequest{{"FC3", 0, 4, []int{0, 1}}, {"FC3", 4, 2, []int{2}}},
+		},
+		// PDU limit of 125 registers
+		{
+			newRegisters([]uint16{0, 100, 124, 125}, []string{"word", "word", "word", "word"}, []string{"FC3", "FC3", "FC3", "FC3"}),
+			100, 500, nil,
+			[]readRequest{{"FC3", 0, 125, []int{0, 1, 2}}, {"FC3", 125, 1, []int{3}}},
+		},
+		// coils are bits, type has no influence on their length
+		{
+			newRegisters([]uint16{0, 1, 2, 5}, []string{"word", "dword", "bool", "word"}, []string{"FC1", "FC1", "FC1", "FC2"}),
+			0, 0, nil,
+			[]readRequest{{"FC1", 0, 3, []int{0, 1, 2}}, {"FC2", 5, 1, []int{3}}},
+		},
+		// 2000 coils in a single request
+		{
+			newRegisters([]uint16{0, 1999, 2000}, []string{"", "", ""}, []string{"FC1", "FC1", "FC1"}),
+			2000, 0, nil,
+			[]readRequest{{"FC1", 0, 2000, []int{0, 1}}, {"FC1", 2000, 1, []int{2}}},
+		},
+		// maximum block length limits coils as well
+		{
+			newRegisters([]uint16{0, 7, 8}, []string{"", "", ""}, []string{"FC1", "FC1", "FC1"}),
+			10, 8, nil,
+			[]readRequest{{"FC1", 0, 8, []int{0, 1}}, {"FC1", 8, 1, []int{2}}},
+		},
+	}
+
+	for each, set := range dataSets {
+
+		requests, err := planReads(set.registers, false, set.maxGap, set.maxLength, set.holes)
+		if err == nil && reflect.DeepEqual(requests, set.awaiting) {
+			t.Logf("planReads() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("planReads() : Test %d FAILED, \nawaiting: %v, \ngot: %v", each+1, set.awaiting, requests)
+		}
+	}
+
+}
+
+func TestPlanReadsFuncCode(t *testing.T) {
+
+	// ---------------------------------------------------------------------------
+	//  CASE: unsupported function code is rejected, not remapped
+	// ---------------------------------------------------------------------------
+	_, err := planReads(newRegisters([]uint16{0}, []string{"word"}, []string{"FC5"}), false, 0, 0, nil)
+	if err != nil {
+		t.Logf("planReads() : FuncCode Test 1 PASSED, got error: %s", err)
+	} else {
+		t.Error("planReads() : FuncCode Test 1 FAILED, awaiting error")
+	}
+
+}
+
+func TestHoleRanges(t *testing.T) {
+
+	device := structures.NewDevice(1, "500ms", "0s", true)
+	device.Holes = &[]structures.AddressRange{{First: 100, Last: 100}, {First: 200, Last: 210}}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: holes of zero-based device are shifted as its registers
+	// ---------------------------------------------------------------------------
+	holes := holeRanges(*device)
+	if reflect.DeepEqual(holes, []structures.AddressRange{{First: 99, Last: 99}, {First: 199, Last: 209}}) && (*device.Holes)[0].First == 100 {
+		t.Log("holeRanges() : Test 1 PASSED.")
+	} else {
+		t.Errorf("holeRanges() : Test 1 FAILED, got: %v", holes)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device without holes
+	// ---------------------------------------------------------------------------
+	device.Holes = nil
+	if holes = holeRanges(*device); holes == nil {
+		t.Log("holeRanges() : Test 2 PASSED.")
+	} else {
+		t.Errorf("holeRanges() : Test 2 FAILED, got: %v", holes)
+	}
+
+}
+
+func TestReadRemoteBlocks(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	var served int32
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}, served: &served}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+	device.MaxGap = 2
+
+	registers := newRegisters(
+		[]uint16{302, 300, 304, 310, 400},
+		[]string{"word", "uint16", "uint32", "int16", "word"},
+		[]string{"FC3", "FC3", "FC3", "FC3", "FC4"},
+	)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: values mapped back onto registers, 3 requests instead of 5
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(address, *device, registers, logger)
+	if err == nil && reflect.DeepEqual(results, []float64{302, 300, 304<<16 | 305, 310, 400}) && atomic.LoadInt32(&served) == 3 {
+		t.Log("ReadRemote() : Blocks Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : Blocks Test 1 FAILED, results: %v, requests: %d, error: %v", results, served, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: hole splits the block
+	// ---------------------------------------------------------------------------
+	atomic.StoreInt32(&served, 0)
+	device.Holes = &[]structures.AddressRange{{First: 301, Last: 301}}
+	results, err = ReadRemote(address, *device, registers, logger)
+	if err == nil && reflect.DeepEqual(results, []float64{302, 300, 304<<16 | 305, 310, 400}) && atomic.LoadInt32(&served) == 4 {
+		t.Log("ReadRemote() : Blocks Test 2 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : Blocks Test 2 FAILED, results: %v, requests: %d, error: %v", results, served, err)
+	}
+
+}
+
+func TestReadRemotePartial(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	var served int32
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1, illegal: []uint16{302, 400}}, served: &served}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	registers := newRegisters(
+		[]uint16{300, 301, 302, 303, 400},
+		[]string{"word", "word", "word", "word", "word"},
+		[]string{"FC3", "FC3", "FC3", "FC3", "FC3"},
+	)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: failed block is read register by register, good values are kept
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(address, *device, registers, logger)
+
+	registerErrors, ok := err.(RegisterErrors)
+	code, isException := ExceptionCode(registerErrors[2])
+	if ok && len(registerErrors) == 2 && isException && code == 2 && registerErrors[4] != nil &&
+		reflect.DeepEqual(results, []float64{300, 301, 0, 303, 0}) && atomic.LoadInt32(&served) == 6 {
+		t.Log("ReadRemote() : Partial Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : Partial Test 1 FAILED, results: %v, requests: %d, error: %v", results, served, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device cannot be read at all
+	// ---------------------------------------------------------------------------
+	stop()
+	results, err = ReadRemote(address, *device, registers, logger)
+	if _, ok := err.(RegisterErrors); err != nil && !ok && results == nil {
+		t.Logf("ReadRemote() : Partial Test 2 PASSED, got error: %s", err)
+	} else {
+		t.Errorf("ReadRemote() : Partial Test 2 FAILED, results: %v, error: %v", results, err)
+	}
+
+}
+
+func TestReadRemoteBits(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	var served int32
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}, served: &served}.start(t)
+	defer stop()
+
+	device := structures.NewDevice(1, "500ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	registers := newRegisters(
+		[]uint16{100, 101, 102, 115, 7, 8, 300},
+		[]string{"bool", "bool", "bool", "bool", "bool", "bool", "word"},
+		[]string{"FC1", "FC1", "FC1", "FC1", "FC2", "FC2", "FC3"},
+	)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: coils and discrete inputs unpacked into 0/1 values
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(address, *device, registers, logger)
+	if err == nil && reflect.DeepEqual(results, []float64{0, 1, 0, 1, 1, 0, 300}) && atomic.LoadInt32(&served) == 4 {
+		t.Log("ReadRemote() : Bits Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : Bits Test 1 FAILED, results: %v, requests: %d, error: %v", results, served, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: unsupported function code
+	// ---------------------------------------------------------------------------
+	registers[0].FuncCode = "FC16"
+	_, err = ReadRemote(address, *device, registers, logger)
+	if err != nil {
+		t.Log("ReadRemote() : Bits Test 2 PASSED.")
+	} else {
+		t.Error("ReadRemote() : Bits Test 2 FAILED, awaiting error")
+	}
+
+}
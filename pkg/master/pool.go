@@ -0,0 +1,281 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// Pool keeps connections open between scrapes, so devices are not connected
+// on every scrape. Connections are keyed by target and transport settings,
+// units behind the same target share the connection and are switched on every
+// transaction (serial port can not be opened twice anyway). Connection is used
+// by one scrape at a time, concurrent scrapes of the same target wait for it.
+type Pool struct {
+	// Idle connection is closed after IdleTimeout, unless the device has its
+	// own idle timeout
+	IdleTimeout time.Duration
+	// Failed connects are not retried until backoff (doubled on every failure
+	// from MinBackoff up to MaxBackoff) is passed
+	MinBackoff, MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	entries map[poolKey]*poolEntry
+}
+
+// poolKey identifies pooled connection
+type poolKey struct {
+	address  string
+	settings structures.Device
+}
+
+// poolEntry is a pooled connection along with its health state
+type poolEntry struct {
+	key poolKey
+	// Holds the token while the connection is in use
+	token chan struct{}
+	// Scrapes using or waiting for the connection, guarded by the pool mutex
+	users int
+
+	// Fields below are guarded by the token (or by the pool mutex if there are
+	// no users)
+	connection  *Connection
+	idleTimeout time.Duration
+	healthy     bool
+	lastUsed    time.Time
+	failures    int
+	retryAt     time.Time
+	lastError   error
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	defaultPoolMinBackoff = time.Second
+	defaultPoolMaxBackoff = 30 * time.Second
+)
+
+// Variables declaration section -----------------------------------------------
+var (
+	// DefaultPool is shared by all the scrapes
+	DefaultPool = NewPool()
+)
+
+// Functions declaration section -----------------------------------------------
+
+// NewPool returns a Pool ready to use.
+func NewPool() *Pool {
+	return &Pool{
+		IdleTimeout: defaultIdleTimeout,
+		MinBackoff:  defaultPoolMinBackoff,
+		MaxBackoff:  defaultPoolMaxBackoff,
+		entries:     make(map[poolKey]*poolEntry),
+	}
+}
+
+// TransportSettings returns device settings identifying its connection, i.e.
+// transport, serial line and timeouts, but not the unit and its registers
+func TransportSettings(device structures.Device) structures.Device {
+	return structures.Device{
+		Timeout:      device.Timeout,
+		RequestDelay: device.RequestDelay,
+		IdleTimeout:  device.IdleTimeout,
+		Transport:    strings.ToLower(device.Transport),
+		Serial:       device.Serial,
+	}
+}
+
+// Acquire returns pooled connection to the address, connecting if there is no
+// healthy one. Connection must be given back by Release. Error (wrapping the
+// context error) is returned if the context is done before the connection is
+// released by concurrent scrape.
+func (pool *Pool) Acquire(ctx context.Context, address string, device structures.Device, logger log.Logger) (*Connection, error) {
+
+	entry := pool.entry(poolKey{address: address, settings: TransportSettings(device)})
+
+	// Wait for the connection to be released by concurrent scrape
+	select {
+	case <-entry.token:
+	case <-ctx.Done():
+		pool.leave(entry)
+		return nil, fmt.Errorf("waiting for connection to address %s: %w", address, ctx.Err())
+	}
+
+	now := time.Now()
+	entry.idleTimeout = parseDuration(device.IdleTimeout, pool.IdleTimeout, "idle timeout", logger)
+
+	// Health check, broken or idle for too long connection is reconnected
+	if entry.connection != nil && (!entry.healthy || now.Sub(entry.lastUsed) > entry.idleTimeout) {
+		level.Debug(logger).Log("msg", "Closing pooled connection", "address", address, "healthy", entry.healthy)
+		entry.connection.Close()
+		entry.connection = nil
+	}
+
+	if entry.connection == nil {
+
+		if now.Before(entry.retryAt) {
+			pool.release(entry)
+			return nil, fmt.Errorf("%w to address %s: retry after %s backoff, last error: %s", errConnect, address, entry.retryAt.Sub(now).Round(time.Millisecond), entry.lastError)
+		}
+
+		connection, error := dial(address, device, entry.idleTimeout, logger)
+		if error != nil {
+			entry.failures++
+			entry.lastError = error
+			entry.retryAt = now.Add(pool.backoff(entry.failures))
+			level.Warn(logger).Log("msg", "Error connecting, backing off", "address", address, "failures", entry.failures, "retry_at", entry.retryAt, "err", error)
+			pool.release(entry)
+			return nil, error
+		}
+
+		connection.entry = entry
+		entry.connection = connection
+		entry.healthy = true
+		entry.failures = 0
+		entry.lastError = nil
+		entry.retryAt = time.Time{}
+	}
+
+	entry.lastUsed = now
+
+	return entry.connection, nil
+}
+
+// Release gives the connection back to the pool, errs are the results of the
+// reads done over it. Connection which is broken (i.e. timed out or out of
+// sync) is reconnected by the next Acquire.
+func (pool *Pool) Release(connection *Connection, errs ...error) {
+
+	entry := connection.entry
+	if entry == nil {
+		connection.Close()
+		return
+	}
+
+	for _, err := range errs {
+		if isBroken(err) {
+			entry.healthy = false
+		}
+	}
+	entry.lastUsed = time.Now()
+
+	pool.release(entry)
+}
+
+// release gives the token of the entry back
+func (pool *Pool) release(entry *poolEntry) {
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	entry.users--
+	entry.token <- struct{}{}
+}
+
+// leave removes the scrape which gave up waiting from the users of the entry
+func (pool *Pool) leave(entry *poolEntry) {
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	entry.users--
+}
+
+// Close closes all the idle pooled connections
+func (pool *Pool) Close() {
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for key, entry := range pool.entries {
+		if entry.users > 0 {
+			continue // in use, closed when idle for too long
+		}
+		if entry.connection != nil {
+			entry.connection.Close()
+		}
+		delete(pool.entries, key)
+	}
+}
+
+// entry returns pool entry of the key, removing entries idle for too long
+func (pool *Pool) entry(key poolKey) *poolEntry {
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.entries == nil {
+		pool.entries = make(map[poolKey]*poolEntry)
+	}
+
+	for other, entry := range pool.entries {
+		if other == key || entry.users > 0 {
+			continue
+		}
+		if time.Since(entry.lastUsed) > entry.idleTimeout && time.Now().After(entry.retryAt) {
+			if entry.connection != nil {
+				entry.connection.Close()
+			}
+			delete(pool.entries, other)
+		}
+	}
+
+	entry, ok := pool.entries[key]
+	if !ok {
+		entry = &poolEntry{key: key, token: make(chan struct{}, 1)}
+		entry.token <- struct{}{}
+		pool.entries[key] = entry
+	}
+	entry.users++
+
+	return entry
+}
+
+// backoff returns delay before the next connect after given number of failures
+func (pool *Pool) backoff(failures int) time.Duration {
+
+	backoff := pool.MinBackoff
+	for i := 1; i < failures && backoff < pool.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > pool.MaxBackoff {
+		backoff = pool.MaxBackoff
+	}
+
+	return backoff
+}
+
+// isBroken reports whether the read error means the connection is unusable,
+// i.e. transport error or read timeout. Requests given up by the scrape context
+// (e.g. which cannot be paced before its deadline) are not sent at all.
+func isBroken(err error) bool {
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if registerErrors, ok := err.(RegisterErrors); ok {
+		for _, registerError := range registerErrors {
+			if isBroken(registerError) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch FailureReason(err) {
+	case ReasonTimeout, ReasonOther, ReasonConnect:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package master
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestPool(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	var connections int32
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}, connections: &connections}.start(t)
+	defer stop()
+
+	registers := newRegisters([]uint16{300}, []string{"word"}, []string{"FC3"})
+
+	device := structures.NewDevice(1, "100ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	offline := *device
+	offline.ModbusID = 4
+
+	pool := NewPool()
+	defer pool.Close()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: healthy connection is reused by the next scrape
+	// ---------------------------------------------------------------------------
+	first, err := pool.Acquire(context.Background(), address, *device, logger)
+	if err != nil {
+		t.Fatalf("Pool.Acquire() : FAILED, %s", err)
+	}
+	_, err = first.Read(*device, registers, logger)
+	pool.Release(first, err)
+
+	second, err := pool.Acquire(context.Background(), address, offline, logger)
+	if err == nil && second == first && atomic.LoadInt32(&connections) == 1 {
+		t.Log("Pool.Acquire() : Test 1 PASSED.")
+	} else {
+		t.Fatalf("Pool.Acquire() : Test 1 FAILED, error: %v, connections: %d", err, connections)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: connection is used by one scrape at a time
+	// ---------------------------------------------------------------------------
+	acquired := make(chan *Connection)
+	go func() {
+		connection, _ := pool.Acquire(context.Background(), address, *device, logger)
+		acquired <- connection
+	}()
+
+	select {
+	case <-acquired:
+		t.Error("Pool.Acquire() : Test 2 FAILED, connection is acquired twice")
+	case <-time.After(50 * time.Millisecond):
+		t.Log("Pool.Acquire() : Test 2 PASSED.")
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: timed out connection is reconnected
+	// ---------------------------------------------------------------------------
+	_, err = second.Read(offline, registers, logger)
+	pool.Release(second, err)
+
+	third := <-acquired
+	if third != nil {
+		_, err = third.Read(*device, registers, logger)
+	}
+	if err == nil && third != second && atomic.LoadInt32(&connections) == 2 {
+		t.Log("Pool.Acquire() : Test 3 PASSED.")
+	} else {
+		t.Errorf("Pool.Acquire() : Test 3 FAILED, error: %v, connections: %d", err, connections)
+	}
+	pool.Release(third)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: connection idle for too long is reconnected
+	// ---------------------------------------------------------------------------
+	pool.IdleTimeout = 50 * time.Millisecond
+	time.Sleep(100 * time.Millisecond)
+
+	fourth, err := pool.Acquire(context.Background(), address, *device, logger)
+	if err == nil {
+		_, err = fourth.Read(*device, registers, logger)
+	}
+	if err == nil && fourth != third && atomic.LoadInt32(&connections) == 3 {
+		t.Log("Pool.Acquire() : Test 4 PASSED.")
+	} else {
+		t.Errorf("Pool.Acquire() : Test 4 FAILED, error: %v, connections: %d", err, connections)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scrape waiting for the connection gives up by its deadline
+	// ---------------------------------------------------------------------------
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = pool.Acquire(ctx, address, *device, logger)
+	if FailureReason(err) == ReasonTimeout && time.Since(start) < time.Second {
+		t.Logf("Pool.Acquire() : Test 5 PASSED, error: %s", err)
+	} else {
+		t.Errorf("Pool.Acquire() : Test 5 FAILED, error: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: requests not sent by the deadline keep the connection
+	// ---------------------------------------------------------------------------
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	_, _, err = fourth.ReadValues(expired, *device, registers, logger)
+	pool.Release(fourth, err)
+
+	fifth, acquireErr := pool.Acquire(context.Background(), address, *device, logger)
+	if err != nil && acquireErr == nil && fifth == fourth && atomic.LoadInt32(&connections) == 3 {
+		t.Logf("Pool.Acquire() : Test 6 PASSED, error: %s", err)
+	} else {
+		t.Errorf("Pool.Acquire() : Test 6 FAILED, error: %v, acquire error: %v, connections: %d", err, acquireErr, connections)
+	}
+	if fifth != nil {
+		pool.Release(fifth)
+	}
+
+}
+
+func TestPoolBackoff(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	// Address nobody listens on
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() : FAILED, %s", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	device := structures.NewDevice(1, "100ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	pool := NewPool()
+	pool.MinBackoff = 100 * time.Millisecond
+	defer pool.Close()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: failed connect is not retried until backoff is passed
+	// ---------------------------------------------------------------------------
+	_, first := pool.Acquire(context.Background(), address, *device, logger)
+	_, second := pool.Acquire(context.Background(), address, *device, logger)
+	if FailureReason(first) == ReasonConnect && FailureReason(second) == ReasonConnect && pool.entries[poolKey{address, TransportSettings(*device)}].failures == 1 {
+		t.Logf("Pool.Acquire() : Backoff Test 1 PASSED, error: %s", second)
+	} else {
+		t.Errorf("Pool.Acquire() : Backoff Test 1 FAILED, errors: %v, %v", first, second)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device is connected once backoff is passed
+	// ---------------------------------------------------------------------------
+	time.Sleep(150 * time.Millisecond)
+
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("Pool.Acquire() : Backoff Test 2 SKIPPED, cannot listen on %s again: %s", address, err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fakeGateway{slave: fakeSlave{id: 1}}.serve(conn)
+		}
+	}()
+	defer listener.Close()
+
+	connection, err := pool.Acquire(context.Background(), address, *device, logger)
+	if err == nil {
+		t.Log("Pool.Acquire() : Backoff Test 2 PASSED.")
+		pool.Release(connection)
+	} else {
+		t.Errorf("Pool.Acquire() : Backoff Test 2 FAILED, error: %s", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: backoff is doubled up to the maximum
+	// ---------------------------------------------------------------------------
+	pool.MinBackoff, pool.MaxBackoff = time.Second, 30*time.Second
+	backoffs := []time.Duration{}
+	for failures := 1; failures <= 7; failures++ {
+		backoffs = append(backoffs, pool.backoff(failures))
+	}
+	if backoffs[0] == time.Second && backoffs[1] == 2*time.Second && backoffs[4] == 16*time.Second && backoffs[6] == 30*time.Second {
+		t.Log("Pool.backoff() : Backoff Test 3 PASSED.")
+	} else {
+		t.Errorf("Pool.backoff() : Backoff Test 3 FAILED, backoffs: %v", backoffs)
+	}
+
+}
@@ -0,0 +1,172 @@
+package master
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// Scheduler queues scrapes of the same target (gateway), so that no more than
+// MaxInFlight of them run at once and consecutive ones are at least Delay apart.
+// Scrape whose deadline is exceeded while waiting is rejected without any I/O.
+type Scheduler struct {
+	// Scrapes of the target running at once, 1 if not set
+	MaxInFlight int
+	// Silent interval between the end of a scrape and the start of the next one
+	Delay time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*targetQueue
+}
+
+// targetQueue is the queue of scrapes of a single target
+type targetQueue struct {
+	// Holds a token for every running scrape
+	slots chan struct{}
+	// Scrapes running or waiting, guarded by the scheduler mutex
+	users int
+	// Next scrape does not start before, guarded by the scheduler mutex
+	free time.Time
+}
+
+// Variables declaration section -----------------------------------------------
+var (
+	// DefaultScheduler is shared by all the scrapes
+	DefaultScheduler = &Scheduler{}
+
+	// Telemetry of the schedulers, registered by the exporter. Targets are
+	// given by scrape requests, so they are not labels (which would be unbounded).
+	schedulerQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "modbus_scheduler_queue_depth",
+			Help: "Scrapes waiting for their target to be free.",
+		},
+	)
+	schedulerWaitSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "modbus_scheduler_wait_seconds",
+			Help:    "Time scrapes waited for their target to be free.",
+			Buckets: []float64{.001, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+	)
+	schedulerRejected = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "modbus_scheduler_rejected_total",
+			Help: "Scrapes rejected because their deadline is exceeded before their target is free.",
+		},
+	)
+
+	// SchedulerCollectors are the telemetry metrics of the schedulers
+	SchedulerCollectors = []prometheus.Collector{schedulerQueueDepth, schedulerWaitSeconds, schedulerRejected}
+)
+
+// Functions declaration section -----------------------------------------------
+
+// Schedule waits until the target is free for the next scrape. Returned done
+// must be called once the scrape is over. Error (wrapping the context error)
+// is returned if the context is done before the target is free, or if the
+// deadline would be exceeded waiting for the delay.
+func (scheduler *Scheduler) Schedule(ctx context.Context, target string) (done func(), err error) {
+
+	if err := ctx.Err(); err != nil {
+		schedulerRejected.Inc()
+		return nil, fmt.Errorf("scrape of target %s rejected: %w", target, err)
+	}
+
+	start := time.Now()
+	queue := scheduler.queue(target)
+
+	schedulerQueueDepth.Inc()
+	defer schedulerQueueDepth.Dec()
+
+	reject := func(err error) (func(), error) {
+		scheduler.leave(queue)
+		schedulerRejected.Inc()
+		return nil, fmt.Errorf("scrape of target %s rejected after %s in queue: %w", target, time.Since(start).Round(time.Millisecond), err)
+	}
+
+	select {
+	case queue.slots <- struct{}{}:
+	case <-ctx.Done():
+		return reject(ctx.Err())
+	}
+
+	scheduler.mu.Lock()
+	wait := time.Until(queue.free)
+	scheduler.mu.Unlock()
+
+	if wait > 0 {
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Now().Add(wait)) {
+			<-queue.slots
+			return reject(context.DeadlineExceeded)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			<-queue.slots
+			return reject(ctx.Err())
+		}
+	}
+
+	schedulerWaitSeconds.Observe(time.Since(start).Seconds())
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			scheduler.mu.Lock()
+			queue.free = time.Now().Add(scheduler.Delay)
+			scheduler.mu.Unlock()
+
+			<-queue.slots
+			scheduler.leave(queue)
+		})
+	}, nil
+}
+
+// queue returns the queue of the target, removing queues of free targets
+func (scheduler *Scheduler) queue(target string) *targetQueue {
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	if scheduler.queues == nil {
+		scheduler.queues = make(map[string]*targetQueue)
+	}
+
+	now := time.Now()
+	for other, queue := range scheduler.queues {
+		if other != target && queue.users == 0 && now.After(queue.free) {
+			delete(scheduler.queues, other)
+		}
+	}
+
+	queue, ok := scheduler.queues[target]
+	if !ok {
+		maxInFlight := scheduler.MaxInFlight
+		if maxInFlight < 1 {
+			maxInFlight = 1
+		}
+		queue = &targetQueue{slots: make(chan struct{}, maxInFlight)}
+		scheduler.queues[target] = queue
+	}
+	queue.users++
+
+	return queue
+}
+
+// leave removes the scrape from the users of the queue
+func (scheduler *Scheduler) leave(queue *targetQueue) {
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	queue.users--
+}
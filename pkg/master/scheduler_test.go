@@ -0,0 +1,169 @@
+package master
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScheduler(t *testing.T) {
+
+	const target = "scheduler-test:502"
+
+	scheduler := &Scheduler{}
+	rejected := testutil.ToFloat64(schedulerRejected)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scrape waits for the running one and is rejected by its deadline
+	// ---------------------------------------------------------------------------
+	done, err := scheduler.Schedule(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Scheduler.Schedule() : FAILED, %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = scheduler.Schedule(ctx, target)
+	if FailureReason(err) == ReasonTimeout && time.Since(start) >= 50*time.Millisecond && testutil.ToFloat64(schedulerRejected) == rejected+1 {
+		t.Logf("Scheduler.Schedule() : Test 1 PASSED, error: %s", err)
+	} else {
+		t.Errorf("Scheduler.Schedule() : Test 1 FAILED, error: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scrape with exceeded deadline is rejected at once
+	// ---------------------------------------------------------------------------
+	_, err = scheduler.Schedule(ctx, target)
+	if FailureReason(err) == ReasonTimeout && testutil.ToFloat64(schedulerRejected) == rejected+2 {
+		t.Log("Scheduler.Schedule() : Test 2 PASSED.")
+	} else {
+		t.Errorf("Scheduler.Schedule() : Test 2 FAILED, error: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: waiting scrape starts once the running one is done
+	// ---------------------------------------------------------------------------
+	scheduled := make(chan error)
+	go func() {
+		done, err := scheduler.Schedule(context.Background(), target)
+		if err == nil {
+			done()
+		}
+		scheduled <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	depth := testutil.ToFloat64(schedulerQueueDepth)
+	done()
+	done() // second call has no effect
+
+	err = <-scheduled
+	if err == nil && depth == 1 && testutil.ToFloat64(schedulerQueueDepth) == 0 {
+		t.Log("Scheduler.Schedule() : Test 3 PASSED.")
+	} else {
+		t.Errorf("Scheduler.Schedule() : Test 3 FAILED, error: %v, queue depth: %v", err, depth)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scrapes of other targets are not queued
+	// ---------------------------------------------------------------------------
+	done, err = scheduler.Schedule(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Scheduler.Schedule() : FAILED, %s", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	other, err := scheduler.Schedule(ctx, "scheduler-test:503")
+	if err == nil {
+		t.Log("Scheduler.Schedule() : Test 4 PASSED.")
+		other()
+	} else {
+		t.Errorf("Scheduler.Schedule() : Test 4 FAILED, error: %s", err)
+	}
+	done()
+
+}
+
+func TestSchedulerDelay(t *testing.T) {
+
+	const target = "scheduler-delay-test:502"
+
+	scheduler := &Scheduler{Delay: 100 * time.Millisecond}
+
+	done, err := scheduler.Schedule(context.Background(), target)
+	if err != nil {
+		t.Fatalf("Scheduler.Schedule() : FAILED, %s", err)
+	}
+	done()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scrape which cannot wait for the delay is rejected at once
+	// ---------------------------------------------------------------------------
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = scheduler.Schedule(ctx, target)
+	if FailureReason(err) == ReasonTimeout && time.Since(start) < 50*time.Millisecond {
+		t.Logf("Scheduler.Schedule() : Delay Test 1 PASSED, error: %s", err)
+	} else {
+		t.Errorf("Scheduler.Schedule() : Delay Test 1 FAILED, error: %v", err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: next scrape starts after the delay
+	// ---------------------------------------------------------------------------
+	done, err = scheduler.Schedule(context.Background(), target)
+	if err == nil && time.Since(start) >= 90*time.Millisecond {
+		t.Log("Scheduler.Schedule() : Delay Test 2 PASSED.")
+		done()
+	} else {
+		t.Errorf("Scheduler.Schedule() : Delay Test 2 FAILED, error: %v, waited: %s", err, time.Since(start))
+	}
+
+}
+
+func TestSchedulerMaxInFlight(t *testing.T) {
+
+	const target = "scheduler-in-flight-test:502"
+
+	scheduler := &Scheduler{MaxInFlight: 2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: up to MaxInFlight scrapes run at once, the next one waits
+	// ---------------------------------------------------------------------------
+	first, err1 := scheduler.Schedule(ctx, target)
+	second, err2 := scheduler.Schedule(ctx, target)
+	_, err3 := scheduler.Schedule(ctx, target)
+	if err1 == nil && err2 == nil && FailureReason(err3) == ReasonTimeout {
+		t.Log("Scheduler.Schedule() : In-flight Test 1 PASSED.")
+	} else {
+		t.Errorf("Scheduler.Schedule() : In-flight Test 1 FAILED, errors: %v, %v, %v", err1, err2, err3)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: waiting scrape runs once one of the running scrapes is over
+	// ---------------------------------------------------------------------------
+	if first != nil {
+		first()
+	}
+	third, err := scheduler.Schedule(context.Background(), target)
+	if err == nil {
+		t.Log("Scheduler.Schedule() : In-flight Test 2 PASSED.")
+		third()
+	} else {
+		t.Errorf("Scheduler.Schedule() : In-flight Test 2 FAILED, error: %v", err)
+	}
+	if second != nil {
+		second()
+	}
+
+}
@@ -0,0 +1,295 @@
+package master
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// frameReader reads a single response frame matching the given request
+type frameReader func(reader *bufio.Reader, aduRequest []byte) ([]byte, error)
+
+// streamClientHandler sends serial line frames (RTU or ASCII) over a TCP
+// socket, as cheap serial gateways do. Framing is checked by the packager
+// (CRC for RTU, LRC for ASCII), frame boundaries are found by readFrame.
+type streamClientHandler struct {
+	modbus.Packager
+	*streamTransporter
+}
+
+// streamTransporter implements modbus.Transporter over a TCP connection
+type streamTransporter struct {
+	// Connect string
+	Address string
+	// Connect & Read timeout
+	Timeout time.Duration
+	// Idle timeout to close the connection
+	IdleTimeout time.Duration
+
+	readFrame frameReader
+
+	mu           sync.Mutex
+	conn         net.Conn
+	reader       *bufio.Reader
+	closeTimer   *time.Timer
+	lastActivity time.Time
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	rtuMaxSize   = 256
+	asciiMaxSize = 513
+)
+
+// Functions declaration section -----------------------------------------------
+
+// newRTUOverTCPClientHandler returns a handler sending RTU frames over TCP
+func newRTUOverTCPClientHandler(address string, slaveID byte, timeout, idleTimeout time.Duration) *streamClientHandler {
+
+	packager := modbus.NewRTUClientHandler("")
+	packager.SlaveId = slaveID
+
+	return &streamClientHandler{
+		Packager: packager,
+		streamTransporter: &streamTransporter{
+			Address:     address,
+			Timeout:     timeout,
+			IdleTimeout: idleTimeout,
+			readFrame:   readRTUFrame,
+		},
+	}
+}
+
+// newASCIIOverTCPClientHandler returns a handler sending ASCII frames over TCP
+func newASCIIOverTCPClientHandler(address string, slaveID byte, timeout, idleTimeout time.Duration) *streamClientHandler {
+
+	packager := modbus.NewASCIIClientHandler("")
+	packager.SlaveId = slaveID
+
+	return &streamClientHandler{
+		Packager: packager,
+		streamTransporter: &streamTransporter{
+			Address:     address,
+			Timeout:     timeout,
+			IdleTimeout: idleTimeout,
+			readFrame:   readASCIIFrame,
+		},
+	}
+}
+
+// SetSlaveID implements clientHandler
+func (mb *streamClientHandler) SetSlaveID(slaveID byte) {
+
+	switch packager := mb.Packager.(type) {
+	case *modbus.RTUClientHandler:
+		packager.SlaveId = slaveID
+	case *modbus.ASCIIClientHandler:
+		packager.SlaveId = slaveID
+	}
+}
+
+// Send writes request frame and reads response frame within Timeout
+func (mb *streamTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if err = mb.connect(); err != nil {
+		return
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+
+	var deadline time.Time
+	if mb.Timeout > 0 {
+		deadline = mb.lastActivity.Add(mb.Timeout)
+	}
+	if err = mb.conn.SetDeadline(deadline); err != nil {
+		return
+	}
+
+	if _, err = mb.conn.Write(aduRequest); err != nil {
+		mb.close()
+		return
+	}
+
+	aduResponse, err = mb.readFrame(mb.reader, aduRequest)
+	if err != nil {
+		// Stream is out of sync after a partial or malformed frame
+		mb.close()
+	}
+	return
+}
+
+// Connect establishes a new connection to the address in Address
+func (mb *streamTransporter) Connect() error {
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	return mb.connect()
+}
+
+// Close closes current connection
+func (mb *streamTransporter) Close() error {
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	return mb.close()
+}
+
+// connect dials Address if not connected, caller must hold the mutex
+func (mb *streamTransporter) connect() error {
+
+	if mb.conn == nil {
+		dialer := net.Dialer{Timeout: mb.Timeout}
+		conn, err := dialer.Dial("tcp", mb.Address)
+		if err != nil {
+			return err
+		}
+		mb.conn = conn
+		mb.reader = bufio.NewReaderSize(conn, asciiMaxSize)
+	}
+	return nil
+}
+
+// close closes the connection, caller must hold the mutex
+func (mb *streamTransporter) close() (err error) {
+
+	if mb.conn != nil {
+		err = mb.conn.Close()
+		mb.conn = nil
+		mb.reader = nil
+	}
+	return
+}
+
+func (mb *streamTransporter) startCloseTimer() {
+
+	if mb.IdleTimeout <= 0 {
+		return
+	}
+	if mb.closeTimer == nil {
+		mb.closeTimer = time.AfterFunc(mb.IdleTimeout, mb.closeIdle)
+	} else {
+		mb.closeTimer.Reset(mb.IdleTimeout)
+	}
+}
+
+// closeIdle closes the connection if last activity is passed behind IdleTimeout
+func (mb *streamTransporter) closeIdle() {
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if time.Since(mb.lastActivity) >= mb.IdleTimeout {
+		mb.close()
+	}
+}
+
+// readRTUFrame reads RTU frame, its length is given by function code and byte count
+//
+//	Slave Address   : 1 byte
+//	Function        : 1 byte
+//	Data            : 0 up to 252 bytes
+//	CRC             : 2 byte
+func readRTUFrame(reader *bufio.Reader, aduRequest []byte) ([]byte, error) {
+
+	var (
+		data         [rtuMaxSize]byte
+		read, length int
+	)
+
+	if _, err := io.ReadFull(reader, data[:2]); err != nil {
+		return nil, err
+	}
+	read = 2
+
+	function := data[1]
+	switch {
+	case function&0x80 != 0: // exception code and CRC
+		length = 5
+	case function == modbus.FuncCodeReadCoils,
+		function == modbus.FuncCodeReadDiscreteInputs,
+		function == modbus.FuncCodeReadHoldingRegisters,
+		function == modbus.FuncCodeReadInputRegisters:
+		if _, err := io.ReadFull(reader, data[2:3]); err != nil {
+			return nil, err
+		}
+		read = 3
+		length = 3 + int(data[2]) + 2
+	case function == modbus.FuncCodeWriteSingleCoil,
+		function == modbus.FuncCodeWriteSingleRegister,
+		function == modbus.FuncCodeWriteMultipleCoils,
+		function == modbus.FuncCodeWriteMultipleRegisters:
+		length = 2 + 4 + 2
+	case function == funcCodeEncapsulatedInterface:
+		// MEI type up to number of objects, then id, length and value of objects
+		if _, err := io.ReadFull(reader, data[2:2+identificationHeaderSize]); err != nil {
+			return nil, err
+		}
+		read = 2 + identificationHeaderSize
+		count := int(data[read-1])
+		for each := 0; each < count; each++ {
+			if read+2 > rtuMaxSize-2 {
+				return nil, fmt.Errorf("modbus: RTU frame length must not be bigger than '%v'", rtuMaxSize)
+			}
+			if _, err := io.ReadFull(reader, data[read:read+2]); err != nil {
+				return nil, err
+			}
+			size := int(data[read+1])
+			read += 2
+			if read+size > rtuMaxSize-2 {
+				return nil, fmt.Errorf("modbus: RTU frame length must not be bigger than '%v'", rtuMaxSize)
+			}
+			if _, err := io.ReadFull(reader, data[read:read+size]); err != nil {
+				return nil, err
+			}
+			read += size
+		}
+		length = read + 2
+	default:
+		return nil, fmt.Errorf("modbus: cannot determine RTU frame length of function '%v'", function)
+	}
+
+	if length > rtuMaxSize {
+		return nil, fmt.Errorf("modbus: RTU frame length '%v' must not be bigger than '%v'", length, rtuMaxSize)
+	}
+	if _, err := io.ReadFull(reader, data[read:length]); err != nil {
+		return nil, err
+	}
+
+	return data[:length], nil
+}
+
+// readASCIIFrame reads ASCII frame, from the starting colon up to CR LF
+func readASCIIFrame(reader *bufio.Reader, aduRequest []byte) ([]byte, error) {
+
+	// Skip noise before the start of frame
+	if _, err := reader.ReadSlice(':'); err != nil {
+		return nil, err
+	}
+
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("modbus: ASCII frame must not be bigger than '%v'", asciiMaxSize)
+		}
+		return nil, err
+	}
+
+	frame := append([]byte{':'}, line...)
+	if len(frame) < 3 || frame[len(frame)-2] != '\r' {
+		return nil, fmt.Errorf("modbus: ASCII frame %q is not ended with CR LF", frame)
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,346 @@
+package master
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// fakeGateway passes serial line frames of fakeSlave over TCP
+type fakeGateway struct {
+	slave       fakeSlave
+	units       []byte // other slave ids answered the same way as slave
+	ascii       bool   // ASCII framing instead of RTU
+	corrupt     bool   // spoil CRC (LRC) of every response
+	silent      bool   // never answer
+	served      *int32 // counts answered requests, if set
+	connections *int32 // counts accepted connections, if set
+}
+
+// lrc calculates MODBUS ASCII checksum
+func lrc(data []byte) byte {
+
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// asciiFrame wraps PDU into ASCII frame (colon, hex encoded payload, LRC and CR LF)
+func asciiFrame(id byte, pdu []byte) []byte {
+
+	payload := append([]byte{id}, pdu...)
+	payload = append(payload, lrc(payload))
+	return []byte(":" + strings.ToUpper(hex.EncodeToString(payload)) + "\r\n")
+}
+
+// start listens on a random local port and returns its address
+func (gw fakeGateway) start(t *testing.T) (string, func()) {
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("fakeGateway: cannot listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if gw.connections != nil {
+				atomic.AddInt32(gw.connections, 1)
+			}
+			go gw.serve(conn)
+		}
+	}()
+
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// answers reports whether a slave with the id is behind the gateway
+func (gw fakeGateway) answers(id byte) bool {
+
+	for _, unit := range gw.units {
+		if unit == id {
+			return true
+		}
+	}
+	return id == gw.slave.id
+}
+
+func (gw fakeGateway) serve(conn net.Conn) {
+
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		var (
+			id       byte
+			request  []byte
+			response []byte
+		)
+
+		if gw.ascii {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			payload, err := hex.DecodeString(strings.TrimSuffix(strings.TrimPrefix(line, ":"), "\r\n"))
+			if err != nil || lrc(payload[:len(payload)-1]) != payload[len(payload)-1] {
+				continue
+			}
+			id, request = payload[0], payload[1:len(payload)-1]
+		} else {
+			// Read device identification request is shorter than others
+			frame := make([]byte, 8)
+			if _, err := io.ReadFull(reader, frame[:2]); err != nil {
+				return
+			}
+			if frame[1] == funcCodeEncapsulatedInterface {
+				frame = frame[:7]
+			}
+			if _, err := io.ReadFull(reader, frame[2:]); err != nil {
+				return
+			}
+			size := len(frame) - 2
+			if crc16(frame[:size]) != uint16(frame[size])|uint16(frame[size+1])<<8 {
+				continue
+			}
+			id, request = frame[0], frame[1:size]
+		}
+
+		if gw.silent || !gw.answers(id) {
+			continue
+		}
+
+		if gw.ascii {
+			response = asciiFrame(id, gw.slave.handle(request))
+			if gw.corrupt {
+				response[len(response)-3]++
+			}
+		} else {
+			response = rtuFrame(id, gw.slave.handle(request))
+			if gw.corrupt {
+				response[len(response)-1]++
+			}
+		}
+
+		if gw.served != nil {
+			atomic.AddInt32(gw.served, 1)
+		}
+		conn.Write(response)
+	}
+}
+
+func TestReadRemoteOverTCP(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	registers := make(structures.Registers, 3)
+
+	registers[0].Address = map[string]uint16{"QF1": 10}
+	registers[0].Type = "word"
+	registers[0].FuncCode = "FC3"
+
+	registers[1].Address = map[string]uint16{"B24_S_Tot": 20}
+	registers[1].Type = "uint32"
+	registers[1].FuncCode = "FC4"
+
+	registers[2].Address = map[string]uint16{"QF2": 300}
+	registers[2].Type = "int16"
+	registers[2].FuncCode = "FC3"
+
+	dataSets := []struct {
+		transport string
+		gateway   fakeGateway
+		valid     bool
+	}{
+		{"rtuovertcp", fakeGateway{slave: fakeSlave{id: 5}}, true},
+		{"asciiovertcp", fakeGateway{slave: fakeSlave{id: 5}, ascii: true}, true},
+		{"rtuovertcp", fakeGateway{slave: fakeSlave{id: 5}, corrupt: true}, false},
+		{"asciiovertcp", fakeGateway{slave: fakeSlave{id: 5}, ascii: true, corrupt: true}, false},
+		{"rtuovertcp", fakeGateway{slave: fakeSlave{id: 5}, silent: true}, false},
+		{"asciiovertcp", fakeGateway{slave: fakeSlave{id: 6}, ascii: true}, false},
+		// Gateway speaks another framing
+		{"rtuovertcp", fakeGateway{slave: fakeSlave{id: 5}, ascii: true}, false},
+	}
+
+	for each, set := range dataSets {
+
+		address, stop := set.gateway.start(t)
+
+		device := structures.NewDevice(5, "200ms", "0s", false)
+		device.Transport = set.transport
+
+		results, err := ReadRemote(address, *device, registers, logger)
+		stop()
+
+		if set.valid {
+			if err == nil && len(results) == 3 && results[0] == 10 && results[1] == 20<<16|21 && results[2] == 300 {
+				t.Logf("ReadRemote() : over TCP Test %d PASSED.", each+1)
+			} else {
+				t.Errorf("ReadRemote() : over TCP Test %d FAILED, results: %v, error: %v", each+1, results, err)
+			}
+		} else {
+			if err != nil {
+				t.Logf("ReadRemote() : over TCP Test %d PASSED, got error: %s", each+1, err)
+			} else {
+				t.Errorf("ReadRemote() : over TCP Test %d FAILED, awaiting error, results: %v", each+1, results)
+			}
+		}
+	}
+
+}
+
+func TestReadRTUFrame(t *testing.T) {
+
+	frames := []struct {
+		frame []byte
+		valid bool
+	}{
+		{rtuFrame(1, []byte{3, 2, 0, 10}), true},
+		{rtuFrame(1, []byte{0x83, 2}), true},
+		{rtuFrame(1, []byte{6, 0, 1, 0, 3}), true},
+		{rtuFrame(1, []byte{43, 14, 1}), false},
+		{rtuFrame(1, []byte{43, 14, 1, 0x81, 0, 0, 2, 0, 3, 'A', 'B', 'C', 1, 1, 'X'}), true},
+		{rtuFrame(1, []byte{43, 14, 1, 0x81, 0, 0, 2, 0, 3, 'A', 'B', 'C', 1, 5, 'X'}), false},
+		{rtuFrame(1, []byte{3, 4, 0, 10})[:6], false},
+	}
+
+	for each, set := range frames {
+
+		frame, err := readRTUFrame(bufio.NewReader(strings.NewReader(string(set.frame))), nil)
+		if set.valid && err == nil && string(frame) == string(set.frame) || !set.valid && err != nil {
+			t.Logf("readRTUFrame() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("readRTUFrame() : Test %d FAILED, frame: % x, error: %v", each+1, frame, err)
+		}
+	}
+
+}
+
+func TestConnectionUnits(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	var served, connections int32
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}, units: []byte{2, 30}, served: &served, connections: &connections}.start(t)
+	defer stop()
+
+	registers := newRegisters([]uint16{300}, []string{"word"}, []string{"FC3"})
+
+	device := structures.NewDevice(1, "200ms", "0s", false)
+	device.Transport = "rtuovertcp"
+
+	connection, err := Dial(address, *device, logger)
+	if err != nil {
+		t.Fatalf("Dial() : FAILED, %s", err)
+	}
+	defer connection.Close()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: units behind the gateway are read over the same connection
+	// ---------------------------------------------------------------------------
+	for each, id := range []byte{1, 2, 30, 4} {
+
+		unit := *device
+		unit.ModbusID = id
+
+		results, err := connection.Read(unit, registers, logger)
+		if id != 4 && err == nil && results[0] == 300 || id == 4 && err != nil {
+			t.Logf("Connection.Read() : Units Test %d PASSED, unit %d, error: %v", each+1, id, err)
+		} else {
+			t.Errorf("Connection.Read() : Units Test %d FAILED, unit %d, results: %v, error: %v", each+1, id, results, err)
+		}
+	}
+
+	if atomic.LoadInt32(&served) == 3 && atomic.LoadInt32(&connections) == 1 {
+		t.Log("Connection.Read() : Units Test 5 PASSED.")
+	} else {
+		t.Errorf("Connection.Read() : Units Test 5 FAILED, requests: %d, connections: %d", served, connections)
+	}
+
+}
+
+func TestConnectionPacing(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	address, stop := fakeGateway{slave: fakeSlave{id: 1}}.start(t)
+	defer stop()
+
+	// Three separate blocks, i.e. three transactions
+	registers := newRegisters([]uint16{300, 310, 320}, []string{"word", "word", "word"}, []string{"FC3", "FC3", "FC3"})
+
+	for each, delay := range []string{"", "50ms"} {
+
+		device := structures.NewDevice(1, "200ms", delay, false)
+		device.Transport = "rtuovertcp"
+
+		connection, err := Dial(address, *device, logger)
+		if err != nil {
+			t.Fatalf("Dial() : FAILED, %s", err)
+		}
+
+		start := time.Now()
+		_, err = connection.Read(*device, registers, logger)
+		elapsed := time.Since(start)
+		connection.Close()
+
+		// ---------------------------------------------------------------------------
+		//  CASE: transactions are paced by the request delay only
+		// ---------------------------------------------------------------------------
+		if err == nil && (delay == "" && elapsed < 50*time.Millisecond || delay != "" && elapsed >= 100*time.Millisecond) {
+			t.Logf("Connection.Read() : Pacing Test %d PASSED, delay '%s', took %s", each+1, delay, elapsed)
+		} else {
+			t.Errorf("Connection.Read() : Pacing Test %d FAILED, delay '%s', took %s, error: %v", each+1, delay, elapsed, err)
+		}
+	}
+	device := structures.NewDevice(1, "200ms", "100ms", false)
+	device.Transport = "rtuovertcp"
+
+	connection, err := Dial(address, *device, logger)
+	if err != nil {
+		t.Fatalf("Dial() : FAILED, %s", err)
+	}
+	defer connection.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err = connection.ReadValues(ctx, *device, registers, logger)
+	elapsed := time.Since(start)
+
+	// ---------------------------------------------------------------------------
+	//  CASE: requests which cannot be paced before the deadline fail at once
+	// ---------------------------------------------------------------------------
+	var registerErrors RegisterErrors
+	if errors.As(err, &registerErrors) && len(registerErrors) == 2 && registerErrors[0] == nil &&
+		FailureReason(registerErrors[1]) == ReasonTimeout && FailureReason(registerErrors[2]) == ReasonTimeout &&
+		elapsed < 100*time.Millisecond {
+		t.Logf("Connection.ReadValues() : Pacing Test 3 PASSED, took %s", elapsed)
+	} else {
+		t.Errorf("Connection.ReadValues() : Pacing Test 3 FAILED, took %s, error: %v", elapsed, err)
+	}
+
+}
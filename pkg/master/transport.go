@@ -0,0 +1,165 @@
+package master
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/goburrow/modbus"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// clientHandler groups the goburrow handler methods used by ReadRemote, i.e.
+// packaging, transport and explicit session management.
+type clientHandler interface {
+	modbus.ClientHandler
+	Connect() error
+	Close() error
+	// SetSlaveID addresses next requests to another unit behind the connection
+	SetSlaveID(slaveID byte)
+}
+
+// tcpClientHandler, rtuClientHandler and asciiClientHandler add unit switching
+// to goburrow handlers
+type (
+	tcpClientHandler   struct{ *modbus.TCPClientHandler }
+	rtuClientHandler   struct{ *modbus.RTUClientHandler }
+	asciiClientHandler struct{ *modbus.ASCIIClientHandler }
+)
+
+// Constants declaration section -----------------------------------------------
+const (
+	transportTCP          = "tcp"
+	transportRTU          = "rtu"
+	transportRTUOverTCP   = "rtuovertcp"
+	transportASCII        = "ascii"
+	transportASCIIOverTCP = "asciiovertcp"
+
+	// Defaults of MODBUS over Serial Line specification (19200 8E1)
+	defaultBaudRate = 19200
+	defaultDataBits = 8
+	defaultParity   = "E"
+	defaultStopBits = 1
+
+	// ASCII mode uses 7 data bits by default
+	defaultASCIIDataBits = 7
+)
+
+// Functions declaration section -----------------------------------------------
+
+// IsSerialTransport reports whether the given transport addresses a local
+// serial port (e.g. '/dev/ttyUSB0') instead of a 'host:port' pair.
+func IsSerialTransport(transport string) bool {
+	switch strings.ToLower(transport) {
+	case transportRTU, transportASCII:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckTransport checks transport and serial parity of the device given in
+// config, empty ones mean defaults
+func CheckTransport(transport, parity string) error {
+
+	switch strings.ToLower(transport) {
+	case "", transportTCP, transportRTU, transportRTUOverTCP, transportASCII, transportASCIIOverTCP:
+	default:
+		return fmt.Errorf("unsupported device transport '%s'", transport)
+	}
+
+	_, error := serialParity(parity)
+
+	return error
+}
+
+// newClientHandler returns a handler for the device transport, connecting to address
+func newClientHandler(address string, device structures.Device, timeout, idleTimeout time.Duration) (clientHandler, error) {
+
+	switch strings.ToLower(device.Transport) {
+
+	case "", transportTCP:
+		handler := modbus.NewTCPClientHandler(address)
+		handler.SlaveId = device.ModbusID
+		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
+		return tcpClientHandler{handler}, nil
+
+	case transportRTU:
+		parity, error := serialParity(device.Serial.Parity)
+		if error != nil {
+			return nil, error
+		}
+		handler := modbus.NewRTUClientHandler(address)
+		handler.SlaveId = device.ModbusID
+		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
+		handler.BaudRate = orDefault(device.Serial.BaudRate, defaultBaudRate)
+		handler.DataBits = orDefault(device.Serial.DataBits, defaultDataBits)
+		handler.StopBits = orDefault(device.Serial.StopBits, defaultStopBits)
+		handler.Parity = parity
+		return rtuClientHandler{handler}, nil
+
+	case transportASCII:
+		parity, error := serialParity(device.Serial.Parity)
+		if error != nil {
+			return nil, error
+		}
+		handler := modbus.NewASCIIClientHandler(address)
+		handler.SlaveId = device.ModbusID
+		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
+		handler.BaudRate = orDefault(device.Serial.BaudRate, defaultBaudRate)
+		handler.DataBits = orDefault(device.Serial.DataBits, defaultASCIIDataBits)
+		handler.StopBits = orDefault(device.Serial.StopBits, defaultStopBits)
+		handler.Parity = parity
+		return asciiClientHandler{handler}, nil
+
+	case transportRTUOverTCP:
+		return newRTUOverTCPClientHandler(address, device.ModbusID, timeout, idleTimeout), nil
+
+	case transportASCIIOverTCP:
+		return newASCIIOverTCPClientHandler(address, device.ModbusID, timeout, idleTimeout), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported device transport '%s'", device.Transport)
+	}
+}
+
+// SetSlaveID implements clientHandler
+func (handler tcpClientHandler) SetSlaveID(slaveID byte) { handler.SlaveId = slaveID }
+
+// SetSlaveID implements clientHandler
+func (handler rtuClientHandler) SetSlaveID(slaveID byte) { handler.SlaveId = slaveID }
+
+// SetSlaveID implements clientHandler
+func (handler asciiClientHandler) SetSlaveID(slaveID byte) { handler.SlaveId = slaveID }
+
+// serialParity converts parity names used in config ('none', 'even', 'odd' or
+// their first letters) into the notation used by serial ports.
+func serialParity(parity string) (string, error) {
+
+	switch strings.ToLower(parity) {
+	case "":
+		return defaultParity, nil
+	case "n", "none":
+		return "N", nil
+	case "e", "even":
+		return "E", nil
+	case "o", "odd":
+		return "O", nil
+	default:
+		return "", fmt.Errorf("unsupported serial parity '%s'", parity)
+	}
+}
+
+// orDefault returns value, or fallback when value is not set
+func orDefault(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
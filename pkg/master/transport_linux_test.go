@@ -0,0 +1,201 @@
+//go:build linux
+// +build linux
+
+package master
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// openPty returns the master side of a new pseudo-terminal and the path of its
+// slave side, which plays the role of a serial port.
+func openPty() (*os.File, string, error) {
+
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rawConn, err := ptmx.SyscallConn()
+	if err != nil {
+		ptmx.Close()
+		return nil, "", err
+	}
+
+	var (
+		number   uint32
+		unlock   int32
+		ioctlErr error
+	)
+	rawConn.Control(func(fd uintptr) {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+			ioctlErr = errno
+			return
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); errno != 0 {
+			ioctlErr = errno
+		}
+	})
+	if ioctlErr != nil {
+		ptmx.Close()
+		return nil, "", ioctlErr
+	}
+
+	return ptmx, fmt.Sprintf("/dev/pts/%d", number), nil
+}
+
+// serveRTU answers RTU read requests arriving on the port until it is closed
+func serveRTU(port io.ReadWriter, slave fakeSlave) {
+
+	var frame []byte
+	buffer := make([]byte, 256)
+
+	for {
+		n, err := port.Read(buffer)
+		if err != nil {
+			return
+		}
+		frame = append(frame, buffer[:n]...)
+
+		// Read requests of function codes 1-4 are always 8 bytes long
+		for len(frame) >= 8 {
+			request := frame[:8]
+			frame = frame[8:]
+			if crc16(request[:6]) != uint16(request[6])|uint16(request[7])<<8 || request[0] != slave.id {
+				continue
+			}
+			port.Write(rtuFrame(slave.id, slave.handle(request[1:6])))
+		}
+	}
+}
+
+// serveASCII answers ASCII read requests arriving on the port until it is closed
+func serveASCII(port io.ReadWriter, slave fakeSlave) {
+
+	reader := bufio.NewReader(port)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		payload, err := hex.DecodeString(strings.TrimSuffix(strings.TrimPrefix(line, ":"), "\r\n"))
+		if err != nil || len(payload) < 3 || lrc(payload[:len(payload)-1]) != payload[len(payload)-1] || payload[0] != slave.id {
+			continue
+		}
+		port.Write(asciiFrame(slave.id, slave.handle(payload[1:len(payload)-1])))
+	}
+}
+
+func TestReadRemoteRTU(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	ptmx, port, err := openPty()
+	if err != nil {
+		t.Skipf("ReadRemote() : RTU tests SKIPPED, cannot open pseudo-terminal: %s", err)
+	}
+	defer ptmx.Close()
+
+	go serveRTU(ptmx, fakeSlave{id: 7})
+
+	device := structures.NewDevice(7, "1000ms", "0s", false)
+	device.Transport = "rtu"
+	device.Serial = structures.Serial{BaudRate: 115200, DataBits: 8, StopBits: 1, Parity: "none"}
+
+	registers := make(structures.Registers, 2)
+
+	registers[0].Address = map[string]uint16{"QF1": 10}
+	registers[0].Type = "word"
+	registers[0].FuncCode = "FC3"
+
+	registers[1].Address = map[string]uint16{"B24_S_Tot": 20}
+	registers[1].Type = "uint32"
+	registers[1].FuncCode = "FC4"
+
+	// ---------------------------------------------------------------------------
+	//  CASE: read fake slave over serial line
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(port, *device, registers, logger)
+	if err == nil && len(results) == 2 && results[0] == 10 && results[1] == 20<<16|21 {
+		t.Log("ReadRemote() : RTU Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : RTU Test 1 FAILED, results: %v, error: %v", results, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: wrong slave id, fake slave keeps silence
+	// ---------------------------------------------------------------------------
+	device.ModbusID = 8
+	device.Timeout = "200ms"
+	_, err = ReadRemote(port, *device, registers, logger)
+	if err != nil {
+		t.Log("ReadRemote() : RTU Test 2 PASSED.")
+	} else {
+		t.Error("ReadRemote() : RTU Test 2 FAILED, awaiting timeout error")
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: serial port does not exist
+	// ---------------------------------------------------------------------------
+	_, err = ReadRemote("/dev/nonexistent", *device, registers, logger)
+	if err != nil {
+		t.Log("ReadRemote() : RTU Test 3 PASSED.")
+	} else {
+		t.Error("ReadRemote() : RTU Test 3 FAILED, awaiting error")
+	}
+
+}
+
+func TestReadRemoteASCII(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	ptmx, port, err := openPty()
+	if err != nil {
+		t.Skipf("ReadRemote() : ASCII tests SKIPPED, cannot open pseudo-terminal: %s", err)
+	}
+	defer ptmx.Close()
+
+	go serveASCII(ptmx, fakeSlave{id: 9})
+
+	device := structures.NewDevice(9, "1000ms", "0s", false)
+	device.Transport = "ascii"
+	device.Serial = structures.Serial{BaudRate: 115200, Parity: "even"}
+
+	registers := make(structures.Registers, 2)
+
+	registers[0].Address = map[string]uint16{"QF1": 10}
+	registers[0].Type = "word"
+	registers[0].FuncCode = "FC3"
+
+	registers[1].Address = map[string]uint16{"B24_S_Tot": 20}
+	registers[1].Type = "uint32"
+	registers[1].FuncCode = "FC4"
+
+	// ---------------------------------------------------------------------------
+	//  CASE: read fake slave over serial line
+	// ---------------------------------------------------------------------------
+	results, err := ReadRemote(port, *device, registers, logger)
+	if err == nil && len(results) == 2 && results[0] == 10 && results[1] == 20<<16|21 {
+		t.Log("ReadRemote() : ASCII Test 1 PASSED.")
+	} else {
+		t.Errorf("ReadRemote() : ASCII Test 1 FAILED, results: %v, error: %v", results, err)
+	}
+
+}
@@ -0,0 +1,149 @@
+package master
+
+import (
+	"encoding/binary"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+)
+
+// fakeSlave answers MODBUS read requests, every register holds its own address
+// and every coil (discrete input) is set on odd addresses.
+type fakeSlave struct {
+	id byte
+	// Reading any of illegal addresses answers 'illegal data address' exception
+	illegal []uint16
+	// Identification objects by id, answered (up to 3 objects per response)
+	// to read device identification request unless nil
+	identification map[byte]string
+}
+
+// handle returns response PDU (function code and data) for the given request PDU
+func (s fakeSlave) handle(request []byte) []byte {
+
+	function := request[0]
+	if function == funcCodeEncapsulatedInterface {
+		return s.identify(request)
+	}
+
+	address := binary.BigEndian.Uint16(request[1:])
+	quantity := binary.BigEndian.Uint16(request[3:])
+
+	for _, illegal := range s.illegal {
+		if illegal >= address && illegal < address+quantity {
+			return []byte{function | 0x80, 0x02}
+		}
+	}
+
+	switch function {
+	case 1, 2:
+		data := make([]byte, 1+(quantity+7)/8)
+		data[0] = byte(len(data) - 1)
+		for i := uint16(0); i < quantity; i++ {
+			if (address+i)%2 == 1 {
+				data[1+i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{function}, data...)
+	case 3, 4:
+		data := make([]byte, 1+2*quantity)
+		data[0] = byte(2 * quantity)
+		for i := uint16(0); i < quantity; i++ {
+			binary.BigEndian.PutUint16(data[1+2*i:], address+i)
+		}
+		return append([]byte{function}, data...)
+	default:
+		return []byte{function | 0x80, 0x01}
+	}
+}
+
+// identify returns response PDU to read device identification request PDU
+func (s fakeSlave) identify(request []byte) []byte {
+
+	if s.identification == nil || len(request) != 4 || request[1] != meiReadDeviceIdentification {
+		return []byte{request[0] | 0x80, 0x01}
+	}
+
+	last := map[byte]int{1: 0x02, 2: 0x7F, 3: 0xFF}[request[2]]
+
+	var ids []int
+	for id := range s.identification {
+		if id >= request[3] && int(id) <= last {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+
+	data := []byte{meiReadDeviceIdentification, request[2], 0x83, 0x00, 0x00, 0x00}
+	if len(ids) > 3 {
+		data[3], data[4] = 0xFF, byte(ids[3])
+		ids = ids[:3]
+	}
+	data[5] = byte(len(ids))
+	for _, id := range ids {
+		data = append(data, byte(id), byte(len(s.identification[byte(id)])))
+		data = append(data, s.identification[byte(id)]...)
+	}
+
+	return append([]byte{request[0]}, data...)
+}
+
+// crc16 calculates MODBUS RTU checksum
+func crc16(data []byte) uint16 {
+
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// rtuFrame wraps PDU into RTU frame (slave id, PDU and CRC)
+func rtuFrame(id byte, pdu []byte) []byte {
+
+	frame := append([]byte{id}, pdu...)
+	crc := crc16(frame)
+	return append(frame, byte(crc), byte(crc>>8))
+}
+
+func TestNewClientHandler(t *testing.T) {
+
+	device := structures.NewDevice(1, "1000ms", "0s", false)
+
+	transports := []struct {
+		transport, parity string
+		valid             bool
+	}{
+		{"", "", true},
+		{"tcp", "", true},
+		{"RTU", "none", true},
+		{"rtu", "x", false},
+		{"ascii", "odd", true},
+		{"rtuovertcp", "", true},
+		{"ASCIIoverTCP", "", true},
+		{"udp", "", false},
+	}
+
+	for each, set := range transports {
+
+		device.Transport = set.transport
+		device.Serial.Parity = set.parity
+
+		_, err := newClientHandler("localhost:1502", *device, time.Second, time.Second)
+		if (err == nil) == set.valid {
+			t.Logf("newClientHandler() : Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("newClientHandler() : Test %d FAILED, transport '%s', parity '%s', error: %v", each+1, set.transport, set.parity, err)
+		}
+	}
+
+}
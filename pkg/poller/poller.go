@@ -0,0 +1,207 @@
+package poller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/collector"
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+	"github.com/NobleD5/modbus_exporter/pkg/workload"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Types declaration section ---------------------------------------------------
+
+// Poller scrapes targets of the configs with 'device_poll_targets' in
+// background, every 'device_poll_interval', and keeps the latest results to be
+// served instead of scraping the target on every request.
+type Poller struct {
+	safeConfig *structures.SafeConfig
+	logger     log.Logger
+
+	mu      sync.RWMutex
+	results map[pollKey]*collector.CachedScrape
+	// Params the targets are polled with, see pollParams
+	polled map[pollKey]structures.Params
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// pollKey identifies polled target of the config
+type pollKey struct {
+	config, target string
+}
+
+// Constants declaration section -----------------------------------------------
+const (
+	// Values are stale once that many polls are missed
+	staleAfterPolls = 2
+)
+
+// Functions declaration section -----------------------------------------------
+
+// New returns a Poller of the config ready to start.
+func New(safeConfig *structures.SafeConfig, logger log.Logger) *Poller {
+	return &Poller{
+		safeConfig: safeConfig,
+		logger:     logger,
+		results:    make(map[pollKey]*collector.CachedScrape),
+	}
+}
+
+// Start starts polling of every target of the current config, results of the
+// targets which are not polled anymore or polled with other params are dropped
+func (poller *Poller) Start() {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	poller.safeConfig.RLock()
+	config := poller.safeConfig.C.Devices
+	poller.safeConfig.RUnlock()
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	polled := make(map[pollKey]structures.Params)
+
+	// Polls do not store results until stale ones are dropped
+	poller.mu.Lock()
+	defer poller.mu.Unlock()
+
+	for _, name := range names {
+
+		params := config[name]
+		if params == nil || len(params.DevicePollTargets) == 0 {
+			continue
+		}
+
+		// Config is validated at load
+		interval, error := time.ParseDuration(params.DevicePollInterval)
+		if error != nil || interval <= 0 {
+			level.Error(poller.logger).Log("msg", "Error parsing poll interval, config is not polled", "config", name, "interval", params.DevicePollInterval, "err", error)
+			continue
+		}
+
+		for _, target := range params.DevicePollTargets {
+			key := pollKey{config: name, target: target}
+			polled[key] = pollParams(params)
+			poller.wg.Add(1)
+			go poller.poll(ctx, key, params, interval)
+		}
+	}
+
+	for key := range poller.results {
+		if params, ok := polled[key]; !ok || !reflect.DeepEqual(params, poller.polled[key]) {
+			delete(poller.results, key)
+		}
+	}
+	poller.polled = polled
+	poller.cancel = cancel
+
+	level.Info(poller.logger).Log("msg", "Started background polling", "targets", len(polled))
+}
+
+// Stop stops polling and waits for running polls to be over, results are kept
+// until the next Start
+func (poller *Poller) Stop() {
+
+	poller.mu.Lock()
+	cancel := poller.cancel
+	poller.cancel = nil
+	poller.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	poller.wg.Wait()
+}
+
+// Restart polls targets of the reloaded config, results of the targets polled
+// the same way are served until they are polled again
+func (poller *Poller) Restart() {
+
+	poller.Stop()
+	poller.Start()
+}
+
+// Result returns the latest result of polling the target of the config, if
+// the target is polled and was polled at least once
+func (poller *Poller) Result(config, target string) (*collector.CachedScrape, bool) {
+
+	poller.mu.RLock()
+	defer poller.mu.RUnlock()
+
+	result, ok := poller.results[pollKey{config: config, target: target}]
+
+	return result, ok
+}
+
+// pollParams returns params the target is polled with, i.e. params of the
+// config apart from the other targets and the file it is loaded from
+func pollParams(params *structures.Params) structures.Params {
+
+	polled := *params
+	polled.DevicePollTargets = nil
+	polled.File = ""
+
+	return polled
+}
+
+// poll scrapes the target every interval until the context is done
+func (poller *Poller) poll(ctx context.Context, key pollKey, params *structures.Params, interval time.Duration) {
+
+	defer poller.wg.Done()
+
+	logger := log.With(poller.logger, "config", key.config, "target", key.target)
+
+	workload, error := workload.PrepareConfig(params, logger)
+	if error == nil {
+		error = collector.CheckWorkload(workload)
+	}
+	if error != nil {
+		level.Error(logger).Log("msg", "Error preparing workload, target is not polled", "error", error.Error())
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+
+		// Poll must be over before the next one
+		pollCtx, cancel := context.WithTimeout(ctx, interval)
+		scrapes, error := collector.ScrapeTarget(pollCtx, key.target, workload, logger)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if error != nil {
+			level.Warn(logger).Log("msg", "Error polling target", "error", error.Error())
+		}
+
+		poller.mu.Lock()
+		poller.results[key] = &collector.CachedScrape{
+			Scrapes:    scrapes,
+			Time:       start,
+			Duration:   time.Since(start),
+			StaleAfter: staleAfterPolls * interval,
+		}
+		poller.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package poller
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NobleD5/modbus_exporter/pkg/structures"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/tbrandon/mbserver"
+)
+
+// waitResult waits for the first poll of the target
+func waitResult(poller *Poller, config, target string) bool {
+
+	for i := 0; i < 200; i++ {
+		if _, ok := poller.Result(config, target); ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestPoller(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	serv := mbserver.NewServer()
+	if err := serv.ListenTCP("localhost:1907"); err != nil {
+		t.Fatalf("Poller : cannot listen, %s", err)
+	}
+	defer serv.Close()
+
+	serv.HoldingRegisters[300] = 2301
+
+	params := &structures.Params{
+		DeviceModbusID:     1,
+		DeviceTimeout:      "500ms",
+		DevicePollInterval: "50ms",
+		DevicePollTargets:  []string{"localhost:1907"},
+		DeviceRegisters: []structures.Register{
+			*structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#300", "FC3", nil),
+		},
+	}
+	safeConfig := structures.NewSafeConfig(&structures.Config{Devices: map[string]*structures.Params{"PLC": params, "IDLE": {}}})
+
+	poller := New(safeConfig, logger)
+	poller.Start()
+	defer poller.Stop()
+
+	// ---------------------------------------------------------------------------
+	//  CASE: target is polled in background
+	// ---------------------------------------------------------------------------
+	if !waitResult(poller, "PLC", "localhost:1907") {
+		t.Fatal("Poller.Result() : Test 1 FAILED, target is not polled")
+	}
+	first, _ := poller.Result("PLC", "localhost:1907")
+	if len(first.Scrapes) == 1 && first.Scrapes[0].Error == nil && first.Scrapes[0].DataUnits[0].Value == 2301 && first.StaleAfter == 100*time.Millisecond {
+		t.Log("Poller.Result() : Test 1 PASSED.")
+	} else {
+		t.Errorf("Poller.Result() : Test 1 FAILED, result: %+v", first)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: result is refreshed every interval
+	// ---------------------------------------------------------------------------
+	time.Sleep(150 * time.Millisecond)
+	second, _ := poller.Result("PLC", "localhost:1907")
+	if second.Time.After(first.Time) {
+		t.Log("Poller.Result() : Test 2 PASSED.")
+	} else {
+		t.Errorf("Poller.Result() : Test 2 FAILED, polled at %s and %s", first.Time, second.Time)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: configs and targets which are not polled have no results
+	// ---------------------------------------------------------------------------
+	_, ok1 := poller.Result("PLC", "localhost:1908")
+	_, ok2 := poller.Result("IDLE", "localhost:1907")
+	if !ok1 && !ok2 {
+		t.Log("Poller.Result() : Test 3 PASSED.")
+	} else {
+		t.Error("Poller.Result() : Test 3 FAILED, awaiting no results")
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: reloaded config is polled after restart
+	// ---------------------------------------------------------------------------
+	reloaded := *params
+	reloaded.DevicePollTargets = []string{"127.0.0.1:1907"}
+
+	safeConfig.Lock()
+	safeConfig.C = &structures.Config{Devices: map[string]*structures.Params{"PLC": &reloaded}}
+	safeConfig.Unlock()
+
+	poller.Restart()
+
+	_, old := poller.Result("PLC", "localhost:1907")
+	if !old && waitResult(poller, "PLC", "127.0.0.1:1907") {
+		t.Log("Poller.Restart() : Test 4 PASSED.")
+	} else {
+		t.Errorf("Poller.Restart() : Test 4 FAILED, old target result: %t", old)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: result of the target polled the same way is kept on restart
+	// ---------------------------------------------------------------------------
+	poller.Restart()
+
+	if _, kept := poller.Result("PLC", "127.0.0.1:1907"); kept {
+		t.Log("Poller.Restart() : Test 5 PASSED.")
+	} else {
+		t.Error("Poller.Restart() : Test 5 FAILED, result is dropped")
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: result of the target polled with other params is dropped on restart
+	// ---------------------------------------------------------------------------
+	serv.HoldingRegisters[301] = 2302
+
+	changed := reloaded
+	changed.DeviceRegisters = []structures.Register{
+		*structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#301", "FC3", nil),
+	}
+
+	safeConfig.Lock()
+	safeConfig.C = &structures.Config{Devices: map[string]*structures.Params{"PLC": &changed}}
+	safeConfig.Unlock()
+
+	restarted := time.Now()
+	poller.Restart()
+
+	result, ok := poller.Result("PLC", "127.0.0.1:1907")
+	if !ok || !result.Time.Before(restarted) {
+		t.Log("Poller.Restart() : Test 6 PASSED.")
+	} else {
+		t.Errorf("Poller.Restart() : Test 6 FAILED, result polled at %s is kept", result.Time)
+	}
+
+}
@@ -20,18 +20,71 @@ type SafeConfig struct {
 // Structures section for config.go
 ////////////////////////////////////////////////////////////////////////////////
 
-// Config structure declaration
-type Config map[string]*Params
+// Config structure declaration, devices (modules) are top level keys of the
+// config, except for 'targets', 'profiles' and 'include'
+type Config struct {
+	Devices  map[string]*Params  `yaml:",inline"`
+	Targets  []Target            `yaml:"targets,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+	// Files (directories, glob patterns) loaded along with the file
+	Include []string `yaml:"include,omitempty"`
+}
+
+// Target structure declaration, i.e. address of the device bound to its config
+type Target struct {
+	Target string            `yaml:"target"`
+	Config string            `yaml:"config"`
+	Group  string            `yaml:"group,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// File the target is loaded from
+	File string `yaml:"-"`
+}
+
+// Profile structure declaration, i.e. registers (and labels) shared by devices
+// of the same model
+type Profile struct {
+	ProfileLabels    map[string]string `yaml:"profile_labels,omitempty"`
+	ProfileRegisters []Register        `yaml:"profile_registers"`
+	// File the profile is loaded from
+	File string `yaml:"-"`
+}
 
 // Params structure declaration
 type Params struct {
 	DeviceTransport           string            `yaml:"device_transport,omitempty"`
+	DeviceBaudRate            int               `yaml:"device_baud_rate,omitempty"`
+	DeviceDataBits            int               `yaml:"device_data_bits,omitempty"`
+	DeviceParity              string            `yaml:"device_parity,omitempty"`
+	DeviceStopBits            int               `yaml:"device_stop_bits,omitempty"`
 	DeviceTimeout             string            `yaml:"device_timeout,omitempty"`
 	DeviceModbusID            byte              `yaml:"device_modbus_id,omitempty"`
 	DeviceZeroBasedAddressing bool              `yaml:"device_zero_based_addressing,omitempty"`
 	DeviceRequestDelay        string            `yaml:"device_request_delay,omitempty"`
+	DeviceIdleTimeout         string            `yaml:"device_idle_timeout,omitempty"`
+	DeviceMaxRegisterGap      uint16            `yaml:"device_max_register_gap,omitempty"`
+	DeviceMaxBlockLength      uint16            `yaml:"device_max_block_length,omitempty"`
+	DeviceRegisterHoles       []string          `yaml:"device_register_holes,omitempty"`
 	DeviceLabels              map[string]string `yaml:"device_labels,omitempty"`
 	DeviceRegisters           []Register        `yaml:"device_registers"`
+	DeviceUnits               []Unit            `yaml:"device_units,omitempty"`
+	// Profile registers are read unless overridden by device registers
+	DeviceProfile string `yaml:"device_profile,omitempty"`
+	// Targets polled in background, instead of on every scrape
+	DevicePollInterval string   `yaml:"device_poll_interval,omitempty"`
+	DevicePollTargets  []string `yaml:"device_poll_targets,omitempty"`
+	// Level of device identification (basic, regular or extended) read and
+	// exported as info metric, none by default
+	DeviceReadIdentification string `yaml:"device_read_identification,omitempty"`
+	// File the device is loaded from
+	File string `yaml:"-"`
+}
+
+// Unit structure declaration, i.e. a slave behind the same gateway (serial line)
+// reading device registers unless it has its own ones
+type Unit struct {
+	UnitModbusID  byte              `yaml:"unit_modbus_id"`
+	UnitLabels    map[string]string `yaml:"unit_labels,omitempty"`
+	UnitRegisters []Register        `yaml:"unit_registers,omitempty"`
 }
 
 // Register structure declaration
@@ -44,6 +97,20 @@ type Register struct {
 	RegisterAddress   string            `yaml:"register_address"`
 	RegisterFuncCode  string            `yaml:"register_func_code,omitempty"`
 	RegisterLabels    map[string]string `yaml:"register_labels,omitempty"`
+	// Engineering units: value * scale * 10^scale_factor + offset
+	RegisterScale              float64 `yaml:"register_scale,omitempty"`
+	RegisterOffset             float64 `yaml:"register_offset,omitempty"`
+	RegisterScaleFactorAddress string  `yaml:"register_scale_factor_address,omitempty"`
+	// Metric exporting the register, 'modbus_<si_name>' gauge by default
+	RegisterMetricName string `yaml:"register_metric_name,omitempty"`
+	RegisterHelp       string `yaml:"register_help,omitempty"`
+	RegisterMetricType string `yaml:"register_metric_type,omitempty"`
+	// Names of the bits of 'bitfield' register (bit 0 is the least significant)
+	// and of the values of 'enum' register
+	RegisterBits   map[int]string `yaml:"register_bits,omitempty"`
+	RegisterStates map[int]string `yaml:"register_states,omitempty"`
+	// Quantity of registers of 'string' register, two characters each
+	RegisterLength uint16 `yaml:"register_length,omitempty"`
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -52,9 +119,29 @@ type Register struct {
 
 // Device structure declaration
 type Device struct {
-	Timeout, RequestDelay string
-	ModbusID              byte
-	ZeroBased             bool
+	Timeout, RequestDelay  string
+	IdleTimeout            string
+	ModbusID               byte
+	ZeroBased              bool
+	Transport              string
+	Serial                 Serial
+	MaxGap, MaxBlockLength uint16
+	// Holes are address ranges never read, parsed once for every unit of the
+	// device (pointer keeps Device comparable)
+	Holes *[]AddressRange
+	// ReadIdentification is the level of device identification read, if any
+	ReadIdentification string
+}
+
+// AddressRange is an inclusive range of register addresses
+type AddressRange struct {
+	First, Last uint16
+}
+
+// Serial structure declaration
+type Serial struct {
+	BaudRate, DataBits, StopBits int
+	Parity                       string
 }
 
 // Registers structure declaration
@@ -66,6 +153,21 @@ type DataUnit struct {
 	Value                                        float64
 	SiName, Type, ByteOrder, WordOrder, FuncCode string
 	Labels                                       map[string]string
+	// Scale (0 means 1) and Offset convert raw value into engineering units
+	Scale, Offset float64
+	// ScaleFactor is the name of the register holding power of ten exponent
+	ScaleFactor string
+	// Internal registers (e.g. scale factors) are read but not exposed
+	Internal bool
+	// Metric exporting the register
+	MetricName, Help, MetricType string
+	// States are names of the bits (bitfield) or of the values (enum) of the
+	// register, every one of them is exported as a series of its own
+	States map[int]string
+	// Length is the quantity of registers of the string register, Text is its
+	// value
+	Length uint16
+	Text   string
 }
 
 // Functions declaration section -----------------------------------------------
@@ -1,9 +1,12 @@
 package workload
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/NobleD5/modbus_exporter/pkg/master"
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
 
 	"github.com/go-kit/kit/log"
@@ -14,6 +17,12 @@ import (
 const (
 	decimalRepresentation     = "dec"
 	hexadecimalRepresentation = "hex"
+
+	// Bits of a bitfield register
+	bitfieldBits = 16
+
+	// Suffix of the info metric, string register value is its label
+	infoSuffix = "_info"
 )
 
 // Functions declaration section -----------------------------------------------
@@ -22,23 +31,17 @@ const (
 func PrepareConfig(receivedDeviceConfig *structures.Params, logger log.Logger) (map[structures.Device]structures.Registers, error) {
 
 	var (
-		// deviceTransport string
-		deviceRegisters []structures.Register
-		deviceLabels    map[string]string
-
-		registerName               string
-		registerRepr, registerAddr string
-		rawRegister                []string
-
-		base int
+		deviceUnits []structures.Unit
 	)
 
-	workload := make(map[structures.Device]structures.Registers)
+	// Device defined with no settings at all is loaded as nil
+	if receivedDeviceConfig == nil {
+		return nil, fmt.Errorf("empty device definition")
+	}
 
-	// deviceTransport = receivedDeviceConfig.DeviceTransport
+	workload := make(map[structures.Device]structures.Registers)
 
-	deviceRegisters = receivedDeviceConfig.DeviceRegisters
-	deviceLabels = receivedDeviceConfig.DeviceLabels
+	deviceUnits = receivedDeviceConfig.DeviceUnits
 
 	device := structures.NewDevice(
 		receivedDeviceConfig.DeviceModbusID,
@@ -46,58 +49,147 @@ func PrepareConfig(receivedDeviceConfig *structures.Params, logger log.Logger) (
 		receivedDeviceConfig.DeviceRequestDelay,
 		receivedDeviceConfig.DeviceZeroBasedAddressing,
 	)
+	device.IdleTimeout = receivedDeviceConfig.DeviceIdleTimeout
+	device.Transport = receivedDeviceConfig.DeviceTransport
+	device.Serial = structures.Serial{
+		BaudRate: receivedDeviceConfig.DeviceBaudRate,
+		DataBits: receivedDeviceConfig.DeviceDataBits,
+		StopBits: receivedDeviceConfig.DeviceStopBits,
+		Parity:   receivedDeviceConfig.DeviceParity,
+	}
+
+	device.MaxGap = receivedDeviceConfig.DeviceMaxRegisterGap
+	device.MaxBlockLength = receivedDeviceConfig.DeviceMaxBlockLength
+
+	holes, error := ParseHoles(receivedDeviceConfig.DeviceRegisterHoles)
+	if error != nil {
+		level.Error(logger).Log("msg", "Error parsing register holes", "error", error)
+		return nil, error
+	}
+	if len(holes) > 0 {
+		device.Holes = &holes
+	}
+	device.ReadIdentification = receivedDeviceConfig.DeviceReadIdentification
 
 	level.Debug(logger).Log(
 		"id", device.ModbusID,
+		"transport", device.Transport,
 		"timeout", device.Timeout,
 		"request_delay", device.RequestDelay,
+		"idle_timeout", device.IdleTimeout,
+		"units", len(deviceUnits),
 	)
 
-	// Check for key existence in a map, create and assign empty struct
-	// of Registers type
-	_, isPresent := workload[*device]
-	if !isPresent {
-		workload[*device] = structures.Registers{}
+	// Device without units is the single unit itself
+	if len(deviceUnits) == 0 {
+		deviceUnits = []structures.Unit{{UnitModbusID: receivedDeviceConfig.DeviceModbusID}}
 	}
 
 	// -------------------------------------------------------------------------
 
+	for _, unit := range deviceUnits {
+
+		unitDevice := *device
+		unitDevice.ModbusID = unit.UnitModbusID
+
+		// Check for key existence in a map, every unit must be read once
+		_, isPresent := workload[unitDevice]
+		if isPresent {
+			error = fmt.Errorf("duplicate unit modbus id '%d'", unit.UnitModbusID)
+			level.Error(logger).Log("msg", "Error parsing device units", "error", error)
+			return nil, error
+		}
+
+		// Unit labels take precedence over device labels
+		unitLabels := make(map[string]string, len(receivedDeviceConfig.DeviceLabels)+len(unit.UnitLabels)+1)
+		for k, v := range receivedDeviceConfig.DeviceLabels {
+			unitLabels[k] = v
+		}
+		for k, v := range unit.UnitLabels {
+			unitLabels[k] = v
+		}
+		if _, ok := unitLabels["unit_id"]; !ok {
+			unitLabels["unit_id"] = strconv.Itoa(int(unit.UnitModbusID))
+		}
+
+		// Unit reads device registers (template) unless it has its own ones
+		unitRegisters := unit.UnitRegisters
+		if len(unitRegisters) == 0 {
+			unitRegisters = receivedDeviceConfig.DeviceRegisters
+		}
+
+		registers, error := prepareRegisters(unitRegisters, unitLabels, logger)
+		if error != nil {
+			return nil, error
+		}
+
+		workload[unitDevice] = registers
+	}
+
+	return workload, nil
+}
+
+// prepareRegisters prepares data units of the registers, every one of them
+// gets its own copy of labels
+func prepareRegisters(deviceRegisters []structures.Register, deviceLabels map[string]string, logger log.Logger) (structures.Registers, error) {
+
+	var (
+		registerName string
+	)
+
 	registers := []structures.DataUnit{}
 
+	// Scale factor registers are read along with the device registers
+	scaleFactors := []structures.DataUnit{}
+	scaleFactorNames := make(map[string]bool)
+
 	// In cycle read and prepare all registers data
 	for _, register := range deviceRegisters {
 
 		registerName = register.RegisterName
 
-		// Split structure field RegisterAddress (eg "dec#001") in two parts
-		rawRegister = strings.Split(register.RegisterAddress, "#")
-		registerRepr = rawRegister[0]
-		registerAddr = rawRegister[1]
+		// Prepare proper modbus register address for use by 'master.ReadRemote'
+		registerValue, error := ParseAddress(register.RegisterAddress)
+		if error != nil {
+			level.Error(logger).Log("msg", "Error parsing register address", "register_address", register.RegisterAddress, "error", error)
+			return nil, error
+		}
 
-		// In case which keyword (dec or hex) is used, decide which base use
-		switch registerRepr {
-		case decimalRepresentation:
-			base = 10
-		case hexadecimalRepresentation:
-			base = 16
+		error = master.CheckFuncCode(register.RegisterFuncCode)
+		if error != nil {
+			error = fmt.Errorf("%s of register '%s'", error.Error(), registerName)
+			level.Error(logger).Log("msg", "Error parsing register function code", "error", error)
+			return nil, error
 		}
 
-		// Prepare proper modbus register address for use by 'master.ReadRemote'
-		registerValue, error := strconv.ParseUint(registerAddr, base, 16)
+		error = CheckStates(register)
 		if error != nil {
-			level.Error(logger).Log("msg", "Error parsing register address", "register_address", registerAddr, "error", error)
+			error = fmt.Errorf("register '%s': %s", registerName, error.Error())
+			level.Error(logger).Log("msg", "Error parsing register states", "error", error)
 			return nil, error
 		}
 
+		error = CheckString(register)
+		if error != nil {
+			error = fmt.Errorf("register '%s': %s", registerName, error.Error())
+			level.Error(logger).Log("msg", "Error parsing string register", "error", error)
+			return nil, error
+		}
+
+		labels := make(map[string]string, len(register.RegisterLabels)+len(deviceLabels)+1)
+		for k, v := range register.RegisterLabels {
+			labels[k] = v
+		}
+
 		dataUnit := structures.NewDataUnit(
-			map[string]uint16{registerName: uint16(registerValue)},
+			map[string]uint16{registerName: registerValue},
 			float64(0),
 			register.RegisterSiName,
 			register.RegisterType,
 			register.RegisterByteOrder,
 			register.RegisterWordOrder,
 			register.RegisterFuncCode,
-			register.RegisterLabels,
+			labels,
 		)
 		_, ok := dataUnit.Labels["register_name"]
 		if !ok {
@@ -111,10 +203,280 @@ func PrepareConfig(receivedDeviceConfig *structures.Params, logger log.Logger) (
 			}
 		}
 
+		dataUnit.Scale = register.RegisterScale
+		dataUnit.Offset = register.RegisterOffset
+
+		dataUnit.MetricName = MetricName(register)
+		dataUnit.Help = register.RegisterHelp
+		dataUnit.MetricType = strings.ToLower(register.RegisterMetricType)
+
+		switch strings.ToLower(register.RegisterType) {
+		case master.TypeBitfield:
+			dataUnit.States = copyStates(register.RegisterBits)
+		case master.TypeEnum:
+			dataUnit.States = copyStates(register.RegisterStates)
+		case master.TypeString:
+			dataUnit.Length = register.RegisterLength
+		}
+
+		if register.RegisterScaleFactorAddress != "" {
+
+			scaleFactor, error := prepareScaleFactor(register)
+			if error != nil {
+				level.Error(logger).Log("msg", "Error parsing register scale factor", "error", error)
+				return nil, error
+			}
+			dataUnit.ScaleFactor = scaleFactor.SiName
+
+			if !scaleFactorNames[scaleFactor.SiName] {
+				scaleFactorNames[scaleFactor.SiName] = true
+				scaleFactors = append(scaleFactors, *scaleFactor)
+			}
+		}
+
 		registers = append(registers, *dataUnit)
 	}
 
-	workload[*device] = registers
+	return append(registers, scaleFactors...), nil
+}
 
-	return workload, nil
+// ParseAddress parses register address given in config (eg "dec#001" or "hex#2ee0")
+func ParseAddress(address string) (uint16, error) {
+
+	var base int
+
+	// Split address (eg "dec#001") in two parts
+	rawRegister := strings.Split(address, "#")
+	if len(rawRegister) != 2 {
+		return 0, fmt.Errorf("register address '%s' must be in 'dec#NNN' or 'hex#NNN' format", address)
+	}
+	registerRepr := rawRegister[0]
+	registerAddr := rawRegister[1]
+
+	// In case which keyword (dec or hex) is used, decide which base use
+	switch registerRepr {
+	case decimalRepresentation:
+		base = 10
+	case hexadecimalRepresentation:
+		base = 16
+	default:
+		return 0, fmt.Errorf("register address '%s' must be in 'dec#NNN' or 'hex#NNN' format", address)
+	}
+
+	value, error := strconv.ParseUint(registerAddr, base, 16)
+	if error != nil {
+		return 0, error
+	}
+
+	return uint16(value), nil
+}
+
+// MetricName returns name of the metric exporting the register, i.e.
+// 'register_metric_name' or 'modbus_<register_si_name>' ('modbus_word' if there
+// is no si name), characters not allowed in metric names are replaced by '_'.
+// String registers are exported as info metrics, named with '_info' suffix.
+func MetricName(register structures.Register) string {
+
+	name := register.RegisterMetricName
+	if name == "" {
+		siName := strings.ToLower(register.RegisterSiName)
+		if siName == "" {
+			siName = "word"
+		}
+		name = "modbus_" + siName
+	}
+	if strings.ToLower(register.RegisterType) == master.TypeString && !strings.HasSuffix(name, infoSuffix) {
+		name += infoSuffix
+	}
+
+	sanitized := []rune(name)
+	for each, r := range sanitized {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+		case r >= '0' && r <= '9' && each > 0:
+		default:
+			sanitized[each] = '_'
+		}
+	}
+
+	return string(sanitized)
+}
+
+// CheckStates checks states of the register given in config: bits of the
+// 'bitfield' registers and values of the 'enum' ones must be named, names of
+// enum values must be unique as each of them is a series. State registers are
+// exported as they are read, i.e. they are neither scaled nor counters.
+func CheckStates(register structures.Register) error {
+
+	regType := strings.ToLower(register.RegisterType)
+
+	switch {
+	case len(register.RegisterBits) > 0 && regType != master.TypeBitfield:
+		return fmt.Errorf("register_bits are supported for 'bitfield' registers only")
+	case len(register.RegisterStates) > 0 && regType != master.TypeEnum:
+		return fmt.Errorf("register_states are supported for 'enum' registers only")
+	case regType != master.TypeBitfield && regType != master.TypeEnum:
+		return nil
+	case regType == master.TypeBitfield && len(register.RegisterBits) == 0:
+		return fmt.Errorf("register_bits must be set for 'bitfield' register")
+	case regType == master.TypeEnum && len(register.RegisterStates) == 0:
+		return fmt.Errorf("register_states must be set for 'enum' register")
+	case register.RegisterScale != 0 || register.RegisterOffset != 0 || register.RegisterScaleFactorAddress != "":
+		return fmt.Errorf("'%s' register cannot be scaled", regType)
+	case strings.ToLower(register.RegisterMetricType) == "counter":
+		return fmt.Errorf("'%s' register cannot be a counter", regType)
+	}
+
+	for _, bit := range sortedStates(register.RegisterBits) {
+		switch {
+		case bit < 0 || bit >= bitfieldBits:
+			return fmt.Errorf("bit %d is out of %d bits of the register", bit, bitfieldBits)
+		case register.RegisterBits[bit] == "":
+			return fmt.Errorf("bit %d must be named", bit)
+		}
+	}
+
+	names := make(map[string]int, len(register.RegisterStates))
+	for _, value := range sortedStates(register.RegisterStates) {
+		name := register.RegisterStates[value]
+		switch other, ok := names[name]; {
+		case value < 0 || value > 0xFFFF:
+			return fmt.Errorf("state value %d is out of register range", value)
+		case name == "":
+			return fmt.Errorf("state value %d must be named", value)
+		case ok:
+			return fmt.Errorf("state '%s' is the name of values %d and %d", name, other, value)
+		}
+		names[name] = value
+	}
+
+	return nil
+}
+
+// sortedStates returns bits (values) of the states in order
+func sortedStates(states map[int]string) []int {
+
+	keys := make([]int, 0, len(states))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
+
+// CheckString checks length of the register given in config, it is set for
+// 'string' registers only. Strings are exported as they are read, i.e. they are
+// neither scaled nor counters, and their characters are in register order.
+func CheckString(register structures.Register) error {
+
+	regType := strings.ToLower(register.RegisterType)
+
+	switch {
+	case register.RegisterLength > 0 && regType != master.TypeString:
+		return fmt.Errorf("register_length is supported for 'string' registers only")
+	case regType != master.TypeString:
+		return nil
+	case register.RegisterLength == 0 || register.RegisterLength > master.MaxRegistersPerRequest:
+		return fmt.Errorf("register_length of 'string' register must be 1 to %d registers", master.MaxRegistersPerRequest)
+	case register.RegisterScale != 0 || register.RegisterOffset != 0 || register.RegisterScaleFactorAddress != "":
+		return fmt.Errorf("'string' register cannot be scaled")
+	case strings.ToLower(register.RegisterMetricType) == "counter":
+		return fmt.Errorf("'string' register cannot be a counter")
+	case master.IsBitAccess(strings.ToUpper(register.RegisterFuncCode)):
+		return fmt.Errorf("'string' register cannot be read by function code '%s'", register.RegisterFuncCode)
+	}
+
+	switch strings.ToLower(register.RegisterWordOrder) {
+	case "", "normal", "none":
+		return nil
+	default:
+		return fmt.Errorf("'string' register does not support word order '%s'", register.RegisterWordOrder)
+	}
+}
+
+// copyStates returns a copy of the states given in config
+func copyStates(states map[int]string) map[int]string {
+
+	copied := make(map[int]string, len(states))
+	for k, v := range states {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+// CheckScaleFactor checks scale factor settings of the register given in config
+func CheckScaleFactor(register structures.Register) error {
+
+	_, error := prepareScaleFactor(register)
+
+	return error
+}
+
+// prepareScaleFactor returns internal data unit reading the scale factor (signed
+// power of ten exponent, as SunSpec does) of the register. Scale factor is read
+// by the same function code as the register itself.
+func prepareScaleFactor(register structures.Register) (*structures.DataUnit, error) {
+
+	address, error := ParseAddress(register.RegisterScaleFactorAddress)
+	if error != nil {
+		return nil, fmt.Errorf("error parsing scale factor address '%s' of register '%s': %s", register.RegisterScaleFactorAddress, register.RegisterName, error.Error())
+	}
+
+	funcCode := strings.ToUpper(register.RegisterFuncCode)
+	switch funcCode {
+	case "", master.InputRegisters:
+		funcCode = master.InputRegisters
+	case master.HoldingRegisters:
+	default:
+		return nil, fmt.Errorf("scale factor is not supported for function code '%s' of register '%s'", register.RegisterFuncCode, register.RegisterName)
+	}
+
+	name := fmt.Sprintf("scale_factor_%s_%d", strings.ToLower(funcCode), address)
+
+	scaleFactor := structures.NewDataUnit(
+		map[string]uint16{name: address},
+		float64(0),
+		name,
+		"int16",
+		"",
+		"",
+		funcCode,
+		nil,
+	)
+	scaleFactor.Internal = true
+
+	return scaleFactor, nil
+}
+
+// ParseHoles converts register holes given in config (eg "dec#100" or
+// "dec#200-dec#210") into address ranges
+func ParseHoles(holes []string) ([]structures.AddressRange, error) {
+
+	ranges := make([]structures.AddressRange, 0, len(holes))
+
+	for _, hole := range holes {
+
+		bounds := strings.SplitN(hole, "-", 2)
+
+		first, error := ParseAddress(strings.TrimSpace(bounds[0]))
+		if error != nil {
+			return nil, fmt.Errorf("error parsing register hole '%s': %s", hole, error.Error())
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, error = ParseAddress(strings.TrimSpace(bounds[1]))
+			if error != nil {
+				return nil, fmt.Errorf("error parsing register hole '%s': %s", hole, error.Error())
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("error parsing register hole '%s': range end is before its start", hole)
+		}
+
+		ranges = append(ranges, structures.AddressRange{First: first, Last: last})
+	}
+
+	return ranges, nil
 }
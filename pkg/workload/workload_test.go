@@ -3,6 +3,7 @@ package workload
 import (
 	"errors"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/NobleD5/modbus_exporter/pkg/structures"
@@ -69,3 +70,302 @@ func TestPrepareConfig(t *testing.T) {
 	}
 
 }
+
+func TestPrepareConfigFuncCode(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	config := &structures.Params{}
+
+	for each, funcCode := range []string{"", "FC1", "fc2", "FC3", "FC4", "FC5", "FC16"} {
+
+		config.DeviceRegisters = []structures.Register{
+			*structures.NewRegister("QF1", "bool", "word", "", "", "dec#1", funcCode, map[string]string{}),
+		}
+
+		_, err := PrepareConfig(config, logger)
+		if (err == nil) == (each < 5) {
+			t.Logf("PrepareConfig() : FuncCode Test %d PASSED.", each+1)
+		} else {
+			t.Errorf("PrepareConfig() : FuncCode Test %d FAILED, function code '%s', error: %v", each+1, funcCode, err)
+		}
+	}
+
+}
+
+func TestPrepareConfigStates(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	bitfield := structures.NewRegister("UPS_STATUS", "ups_status", "bitfield", "", "", "dec#300", "FC3", nil)
+	bitfield.RegisterBits = map[int]string{0: "on_battery", 3: "overload"}
+
+	enum := structures.NewRegister("UPS_MODE", "ups_mode", "enum", "", "", "dec#301", "FC3", nil)
+	enum.RegisterStates = map[int]string{0: "off", 1: "standby", 2: "run"}
+
+	config := &structures.Params{DeviceRegisters: []structures.Register{*bitfield, *enum}}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: names of bits and values are states of the data units
+	// ---------------------------------------------------------------------------
+	workload, err := PrepareConfig(config, logger)
+	if err != nil {
+		t.Fatalf("PrepareConfig() : States Test 1 FAILED, %s", err)
+	}
+
+	for _, registers := range workload {
+		if len(registers) == 2 && registers[0].States[3] == "overload" && len(registers[0].States) == 2 &&
+			registers[1].States[2] == "run" && len(registers[1].States) == 3 {
+			t.Log("PrepareConfig() : States Test 1 PASSED.")
+		} else {
+			t.Errorf("PrepareConfig() : States Test 1 FAILED, got: %v", registers)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: states are copied, config is left as it is
+	// ---------------------------------------------------------------------------
+	for _, registers := range workload {
+		registers[0].States[5] = "fault"
+	}
+	if len(config.DeviceRegisters[0].RegisterBits) == 2 {
+		t.Log("PrepareConfig() : States Test 2 PASSED.")
+	} else {
+		t.Errorf("PrepareConfig() : States Test 2 FAILED, got: %v", config.DeviceRegisters[0].RegisterBits)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: bitfield register without bits
+	// ---------------------------------------------------------------------------
+	bitfield.RegisterBits = nil
+	config.DeviceRegisters = []structures.Register{*bitfield}
+
+	awaiting := "register 'UPS_STATUS': register_bits must be set for 'bitfield' register"
+	_, err = PrepareConfig(config, logger)
+	if err != nil && err.Error() == awaiting {
+		t.Log("PrepareConfig() : States Test 3 PASSED.")
+	} else {
+		t.Errorf("PrepareConfig() : States Test 3 FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", awaiting, err)
+	}
+
+}
+
+func TestPrepareConfigString(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowError())
+
+	serial := structures.NewRegister("SERIAL", "serial_number", "string", "", "", "dec#130", "FC3", nil)
+	serial.RegisterLength = 10
+
+	firmware := structures.NewRegister("FIRMWARE", "", "string", "", "", "dec#140", "FC3", nil)
+	firmware.RegisterLength = 4
+	firmware.RegisterMetricName = "device_firmware_info"
+
+	config := &structures.Params{DeviceRegisters: []structures.Register{*serial, *firmware}}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: string registers are info metrics of the given length
+	// ---------------------------------------------------------------------------
+	workload, err := PrepareConfig(config, logger)
+	if err != nil {
+		t.Fatalf("PrepareConfig() : String Test 1 FAILED, %s", err)
+	}
+
+	for _, registers := range workload {
+		if registers[0].Length == 10 && registers[0].MetricName == "modbus_serial_number_info" &&
+			registers[1].Length == 4 && registers[1].MetricName == "device_firmware_info" {
+			t.Log("PrepareConfig() : String Test 1 PASSED.")
+		} else {
+			t.Errorf("PrepareConfig() : String Test 1 FAILED, got: %v", registers)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: invalid string registers
+	// ---------------------------------------------------------------------------
+	invalid := []struct {
+		update   func(register *structures.Register)
+		awaiting string
+	}{
+		{func(register *structures.Register) { register.RegisterLength = 0 }, "register_length of 'string' register must be 1 to 125 registers"},
+		{func(register *structures.Register) { register.RegisterLength = 126 }, "register_length of 'string' register must be 1 to 125 registers"},
+		{func(register *structures.Register) { register.RegisterScale = 0.1 }, "'string' register cannot be scaled"},
+		{func(register *structures.Register) { register.RegisterWordOrder = "swapped" }, "'string' register does not support word order 'swapped'"},
+		{func(register *structures.Register) { register.RegisterFuncCode = "FC1" }, "'string' register cannot be read by function code 'FC1'"},
+		{func(register *structures.Register) { register.RegisterType = "uint16" }, "register_length is supported for 'string' registers only"},
+	}
+
+	for each, testCase := range invalid {
+
+		register := *serial
+		testCase.update(&register)
+		config.DeviceRegisters = []structures.Register{register}
+
+		awaiting := "register 'SERIAL': " + testCase.awaiting
+		_, err := PrepareConfig(config, logger)
+		if err != nil && err.Error() == awaiting {
+			t.Logf("PrepareConfig() : String Test %d PASSED.", each+2)
+		} else {
+			t.Errorf("PrepareConfig() : String Test %d FAILED, \nawaiting: \"%s\", \ngot: \"%v\"", each+2, awaiting, err)
+		}
+	}
+
+}
+
+func TestPrepareConfigScaleFactor(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	config := &structures.Params{}
+
+	voltageA := structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#100", "FC3", map[string]string{})
+	voltageA.RegisterScaleFactorAddress = "dec#103"
+	voltageB := structures.NewRegister("U_B", "voltage", "uint16", "", "", "dec#101", "FC3", map[string]string{})
+	voltageB.RegisterScaleFactorAddress = "hex#67"
+	current := structures.NewRegister("I_A", "current", "uint16", "", "", "dec#102", "", map[string]string{})
+	current.RegisterScale = 0.01
+	current.RegisterOffset = 1
+	current.RegisterScaleFactorAddress = "dec#104"
+
+	config.DeviceRegisters = []structures.Register{*voltageA, *voltageB, *current}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: scale factors are appended once per address and function code
+	// ---------------------------------------------------------------------------
+	workload, err := PrepareConfig(config, logger)
+	for _, registers := range workload {
+		if err == nil && len(registers) == 5 &&
+			registers[0].ScaleFactor == "scale_factor_fc3_103" && registers[1].ScaleFactor == "scale_factor_fc3_103" &&
+			registers[2].Scale == 0.01 && registers[2].Offset == 1 && registers[2].ScaleFactor == "scale_factor_fc4_104" &&
+			registers[3].Internal && registers[3].Address["scale_factor_fc3_103"] == 103 && registers[3].Type == "int16" &&
+			registers[4].Internal && registers[4].FuncCode == "FC4" {
+			t.Log("PrepareConfig() : ScaleFactor Test 1 PASSED.")
+		} else {
+			t.Errorf("PrepareConfig() : ScaleFactor Test 1 FAILED, registers: %v, error: %v", registers, err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: invalid scale factor address and bit registers
+	// ---------------------------------------------------------------------------
+	invalid := []struct{ address, funcCode string }{{"dec#XY", "FC3"}, {"dec#104", "FC1"}}
+	for each, set := range invalid {
+
+		register := structures.NewRegister("I_A", "current", "uint16", "", "", "dec#102", set.funcCode, map[string]string{})
+		register.RegisterScaleFactorAddress = set.address
+		config.DeviceRegisters = []structures.Register{*register}
+
+		_, err = PrepareConfig(config, logger)
+		if err != nil {
+			t.Logf("PrepareConfig() : ScaleFactor Test %d PASSED, got error: %s", each+2, err)
+		} else {
+			t.Errorf("PrepareConfig() : ScaleFactor Test %d FAILED, awaiting error", each+2)
+		}
+	}
+
+}
+
+func TestPrepareConfigUnits(t *testing.T) {
+
+	logger := log.NewLogfmtLogger(os.Stdout)
+	logger = level.NewFilter(logger, level.AllowDebug())
+
+	config := &structures.Params{
+		DeviceModbusID: 1,
+		DeviceLabels:   map[string]string{"vendor": "VENDOR", "meter": "main"},
+		DeviceRegisters: []structures.Register{
+			*structures.NewRegister("U_A", "voltage", "uint16", "", "", "dec#300", "FC3", map[string]string{"phase": "A"}),
+		},
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: device without units is the single unit
+	// ---------------------------------------------------------------------------
+	workload, err := PrepareConfig(config, logger)
+	for device, registers := range workload {
+		if err == nil && len(workload) == 1 && device.ModbusID == 1 && registers[0].Labels["unit_id"] == "1" {
+			t.Log("PrepareConfig() : Units Test 1 PASSED.")
+		} else {
+			t.Errorf("PrepareConfig() : Units Test 1 FAILED, workload: %v, error: %v", workload, err)
+		}
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: units share device registers unless they have their own ones
+	// ---------------------------------------------------------------------------
+	config.DeviceUnits = []structures.Unit{
+		{UnitModbusID: 2, UnitLabels: map[string]string{"meter": "M2"}},
+		{UnitModbusID: 3, UnitLabels: map[string]string{"meter": "M3"}},
+		{UnitModbusID: 30, UnitRegisters: []structures.Register{
+			*structures.NewRegister("I_A", "current", "uint16", "", "", "dec#310", "FC3", nil),
+			*structures.NewRegister("I_B", "current", "uint16", "", "", "dec#311", "FC3", nil),
+		}},
+	}
+
+	workload, err = PrepareConfig(config, logger)
+
+	units := make(map[byte]structures.Registers)
+	for device, registers := range workload {
+		units[device.ModbusID] = registers
+	}
+
+	if err == nil && len(units) == 3 &&
+		len(units[2]) == 1 && units[2][0].Labels["meter"] == "M2" && units[2][0].Labels["unit_id"] == "2" && units[2][0].Labels["phase"] == "A" &&
+		len(units[3]) == 1 && units[3][0].Labels["meter"] == "M3" && units[3][0].Labels["unit_id"] == "3" &&
+		len(units[30]) == 2 && units[30][1].Labels["meter"] == "main" && units[30][1].Labels["register_name"] == "I_B" && units[30][1].Labels["unit_id"] == "30" {
+		t.Log("PrepareConfig() : Units Test 2 PASSED.")
+	} else {
+		t.Errorf("PrepareConfig() : Units Test 2 FAILED, workload: %v, error: %v", workload, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: config labels are not modified
+	// ---------------------------------------------------------------------------
+	if len(config.DeviceRegisters[0].RegisterLabels) == 1 && len(config.DeviceLabels) == 2 {
+		t.Log("PrepareConfig() : Units Test 3 PASSED.")
+	} else {
+		t.Errorf("PrepareConfig() : Units Test 3 FAILED, register labels: %v, device labels: %v", config.DeviceRegisters[0].RegisterLabels, config.DeviceLabels)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: duplicate unit
+	// ---------------------------------------------------------------------------
+	config.DeviceUnits = append(config.DeviceUnits, structures.Unit{UnitModbusID: 3})
+	_, err = PrepareConfig(config, logger)
+	if err != nil {
+		t.Logf("PrepareConfig() : Units Test 4 PASSED, got error: %s", err)
+	} else {
+		t.Error("PrepareConfig() : Units Test 4 FAILED, awaiting error")
+	}
+
+}
+
+func TestParseHoles(t *testing.T) {
+
+	// ---------------------------------------------------------------------------
+	//  CASE: single addresses and ranges
+	// ---------------------------------------------------------------------------
+	holes, err := ParseHoles([]string{"dec#100", "hex#C8-hex#D2", "dec#300 - dec#301"})
+	if err == nil && reflect.DeepEqual(holes, []structures.AddressRange{{First: 100, Last: 100}, {First: 200, Last: 210}, {First: 300, Last: 301}}) {
+		t.Log("ParseHoles() : Test 1 PASSED.")
+	} else {
+		t.Errorf("ParseHoles() : Test 1 FAILED, got: %v, error: %v", holes, err)
+	}
+
+	// ---------------------------------------------------------------------------
+	//  CASE: invalid holes
+	// ---------------------------------------------------------------------------
+	for each, hole := range []string{"100", "dec#110-dec#100", "dec#100-hex#XY"} {
+		_, err = ParseHoles([]string{hole})
+		if err != nil {
+			t.Logf("ParseHoles() : Test %d PASSED.", each+2)
+		} else {
+			t.Errorf("ParseHoles() : Test %d FAILED, awaiting error for '%s'", each+2, hole)
+		}
+	}
+
+}